@@ -0,0 +1,20 @@
+package amper
+
+// Account represents an AWS account that a Container's attachments are
+// ultimately rendered against.
+type Account struct {
+	Name string
+	ID   string
+}
+
+func (a *Account) String() string {
+	return a.Name
+}
+
+func (a *Account) PrincipalName() string {
+	return a.Name
+}
+
+func (a *Account) PrincipalType() PrincipalType {
+	return PrincipalRole
+}
@@ -7,9 +7,9 @@ import (
 )
 
 type Attachment struct {
-	pt      *PolicyTemplate
-	account *Account
-	vars    map[string]string
+	pt        *PolicyTemplate
+	principal Principal
+	vars      map[string]string
 }
 
 func (a Attachment) String() string {
@@ -24,6 +24,24 @@ type Container struct {
 	ID string
 
 	attachments []*Attachment
+
+	exclusive       bool
+	attachmentState map[string]*attachmentState
+}
+
+// SetExclusive toggles exclusive-attachment reconciliation for this
+// container. When exclusive, Reconcile treats any managed policy
+// (customer-managed, or AWS-managed unless WithKeepAWSManagedPolicies is
+// set) attached to one of the container's principals that isn't declared
+// in an attached template's ManagedPolicyARNs, and any inline policy on a role principal not named
+// via WithOwnedInlinePolicyNames, as drift, and removes it unless
+// ReconcileOptions say otherwise. Service-role trust policies are not
+// enumerated by Reconcile; see Container.Reconcile.
+func (c *Container) SetExclusive(exclusive bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.exclusive = exclusive
 }
 
 func (c *Container) AddPolicyTemplate(pt *PolicyTemplate) error {
@@ -38,6 +56,10 @@ func (c *Container) AddPolicyTemplate(pt *PolicyTemplate) error {
 		return fmt.Errorf("policy '%s' is in unknown state", pt.Key)
 	}
 
+	if err := c.amper.validateTemplate(pt); err != nil {
+		return fmt.Errorf("policy template '%s' failed validation: %w", pt.Key, err)
+	}
+
 	pt.amper = c.amper
 	pt.container = c
 
@@ -46,7 +68,7 @@ func (c *Container) AddPolicyTemplate(pt *PolicyTemplate) error {
 	return nil
 }
 
-func (c *Container) AddAttachment(policyTemplateID string, accountName string, vars map[string]string) (*Attachment, error) {
+func (c *Container) AddAttachment(policyTemplateID string, principalType PrincipalType, principalName string, vars map[string]string) (*Attachment, error) {
 	c.amper.RLock()
 	defer c.amper.RUnlock()
 
@@ -59,10 +81,14 @@ func (c *Container) AddAttachment(policyTemplateID string, accountName string, v
 		return nil, fmt.Errorf("cannot add attachment, unknown policy template '%s' in container '%s'", policyTemplateID, c.ID)
 	}
 
-	account, ok := c.amper.accounts[accountName]
+	principal, err := c.amper.lookupPrincipal(principalType, principalName)
 
-	if !ok {
-		return nil, fmt.Errorf("cannot add attachment, unknown account '%s' in container '%s'", accountName, c.ID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot add attachment, %w in container '%s'", err, c.ID)
+	}
+
+	if pt.ServiceRole != nil && principalType != PrincipalRole {
+		return nil, fmt.Errorf("cannot add attachment, policy template '%s' declares a service role which only applies to role principals", policyTemplateID)
 	}
 
 	for _, varName := range pt.Vars {
@@ -72,9 +98,9 @@ func (c *Container) AddAttachment(policyTemplateID string, accountName string, v
 	}
 
 	attachment := &Attachment{
-		pt:      pt,
-		account: account,
-		vars:    vars,
+		pt:        pt,
+		principal: principal,
+		vars:      vars,
 	}
 
 	c.attachments = append(c.attachments, attachment)
@@ -95,28 +121,48 @@ func (c *Container) Policy() (_ *Policy, err error, missing []*Attachment) {
 
 	accountPolicies := make(map[string][]*IAMPolicyDoc)
 	accountRolePolicies := make(map[string][]*IAMPolicyDoc)
+	userPolicies := make(map[string][]*IAMPolicyDoc)
+	groupPolicies := make(map[string][]*IAMPolicyDoc)
 	serviceRolePolicies := make(map[string]map[string]*ServiceRolePolicy)
-	scopeMap := make(map[string]map[string]bool)
+	managedPolicyARNs := make(map[string]map[string]bool)
+	scopes := make(map[string]*principalScope)
+	var validationErrs ValidationErrors
+
+	policiesFor := func(pType PrincipalType) map[string][]*IAMPolicyDoc {
+		switch pType {
+		case PrincipalUser:
+			return userPolicies
+		case PrincipalGroup:
+			return groupPolicies
+		default:
+			return accountPolicies
+		}
+	}
 
 	for _, a := range c.attachments {
-		if serviceRolePolicies[a.account.Name] == nil {
-			serviceRolePolicies[a.account.Name] = make(map[string]*ServiceRolePolicy)
+		name := a.principal.PrincipalName()
+		pType := a.principal.PrincipalType()
+		docs := policiesFor(pType)
+		principalKey := string(pType) + ":" + name
+
+		if pType == PrincipalRole && serviceRolePolicies[principalKey] == nil {
+			serviceRolePolicies[principalKey] = make(map[string]*ServiceRolePolicy)
 		}
 
-		pd, err := a.pt.renderTemplate(c, a.account, a.vars)
+		pd, err := a.pt.renderTemplate(c, a.principal, a.vars)
 
 		if err != nil {
 			return nil, err, nil
 		}
 
-		if scopeMap[a.account.Name] == nil {
-			scopeMap[a.account.Name] = make(map[string]bool)
+		if scopes[principalKey] == nil {
+			scopes[principalKey] = &principalScope{pType: pType, name: name, scope: make(map[string]bool)}
 		}
 
 		if pd == nil {
 			// Policy not found
 			fmt.Printf("[WARN] Policy template '%s' not found\n", a.pt.Key)
-			accountPolicies[a.account.Name] = append(accountPolicies[a.account.Name], &IAMPolicyDoc{})
+			docs[name] = append(docs[name], &IAMPolicyDoc{})
 			missing = append(missing, a)
 			continue
 		}
@@ -125,31 +171,60 @@ func (c *Container) Policy() (_ *Policy, err error, missing []*Attachment) {
 			return nil, fmt.Errorf("Unsupported policy version '%s'", pd.Version), nil
 		}
 
-		accountPolicies[a.account.Name] = append(accountPolicies[a.account.Name], pd)
+		actx := AttachmentContext{Container: c, Principal: a.principal, Vars: a.vars}
+
+		if err := c.amper.validateRendered(a.pt, pd, actx); err != nil {
+			validationErrs = append(validationErrs, fmt.Errorf("policy template '%s' for '%s': %w", a.pt.Key, name, err))
+			continue
+		}
+
+		docs[name] = append(docs[name], pd)
 
 		for _, s := range a.pt.Scope {
-			scopeMap[a.account.Name][s] = true
+			scopes[principalKey].scope[s] = true
+		}
+
+		arns, err := a.pt.renderManagedPolicyARNs(a.principal, a.vars)
+
+		if err != nil {
+			return nil, err, nil
+		}
+
+		if len(arns) > 0 && managedPolicyARNs[principalKey] == nil {
+			managedPolicyARNs[principalKey] = make(map[string]bool)
+		}
+
+		for _, arn := range arns {
+			managedPolicyARNs[principalKey][arn] = true
+
+			for _, s := range c.amper.managedPolicyScopeResolver.ResolveScopes(arn) {
+				scopes[principalKey].scope[s] = true
+			}
 		}
 
 		if a.pt.ServiceRole != nil {
 			srp := &ServiceRolePolicy{}
 
-			srp.Policy, err = a.pt.renderServiceRole(c, a.account, a.vars)
+			srp.Policy, err = a.pt.renderServiceRole(c, a.principal, a.vars)
 
 			if err != nil {
 				return nil, err, nil
 			}
 
-			srp.AssumeRolePolicy, err = a.pt.renderServiceAssumeRole(c, a.account, a.vars)
+			srp.AssumeRolePolicy, err = a.pt.renderServiceAssumeRole(c, a.principal, a.vars)
 
 			if err != nil {
 				return nil, err, nil
 			}
 
-			serviceRolePolicies[a.account.Name][a.pt.ServiceRole.Name] = srp
+			serviceRolePolicies[principalKey][a.pt.ServiceRole.Name] = srp
 		}
 	}
 
+	if len(validationErrs) > 0 {
+		return nil, validationErrs, nil
+	}
+
 	allowAll := &IAMPolicyStatement{
 		Sid:       "AllowAll",
 		Effect:    "Allow",
@@ -157,10 +232,13 @@ func (c *Container) Policy() (_ *Policy, err error, missing []*Attachment) {
 		Resources: []string{"*"},
 	}
 
-	for account, po := range scopeMap {
+	for _, ps := range scopes {
+		name := ps.name
+		docs := policiesFor(ps.pType)
+
 		var denyUnknown *IAMPolicyStatement
 
-		if len(po) == 0 {
+		if len(ps.scope) == 0 {
 			// Nothing will be allowed!
 			denyUnknown = &IAMPolicyStatement{
 				Sid:       "DenyAll",
@@ -169,38 +247,57 @@ func (c *Container) Policy() (_ *Policy, err error, missing []*Attachment) {
 				Resources: []string{"*"},
 			}
 		} else {
-			scopes := make([]string, 0, len(po))
+			actions := make([]string, 0, len(ps.scope))
 
-			for k := range po {
-				scopes = append(scopes, k)
+			for k := range ps.scope {
+				actions = append(actions, k)
 			}
 
-			sort.Sort(sort.StringSlice(scopes))
+			sort.Sort(sort.StringSlice(actions))
 
 			denyUnknown = &IAMPolicyStatement{
 				Sid:        "DenyUnknownServices",
 				Effect:     "Deny",
-				NotActions: scopes,
+				NotActions: actions,
 				Resources:  []string{"*"},
 			}
 		}
 
-		accountPolicies[account] = append(accountPolicies[account], &IAMPolicyDoc{
+		docs[name] = append(docs[name], &IAMPolicyDoc{
 			Statements: []*IAMPolicyStatement{denyUnknown},
 		})
 
-		accountRolePolicies[account] = accountPolicies[account]
+		if ps.pType == PrincipalRole {
+			accountRolePolicies[name] = docs[name]
+		}
 
-		if len(po) > 0 {
-			accountPolicies[account] = append(accountPolicies[account], &IAMPolicyDoc{
+		if len(ps.scope) > 0 {
+			docs[name] = append(docs[name], &IAMPolicyDoc{
 				Statements: []*IAMPolicyStatement{allowAll},
 			})
 		}
 	}
 
+	accountManagedPolicyARNs := make(map[string][]string, len(managedPolicyARNs))
+
+	for principalKey, arns := range managedPolicyARNs {
+		list := make([]string, 0, len(arns))
+
+		for arn := range arns {
+			list = append(list, arn)
+		}
+
+		sort.Strings(list)
+
+		accountManagedPolicyARNs[principalKey] = list
+	}
+
 	p.AccountPolicies = accountPolicies
 	p.AccountRolePolicies = accountRolePolicies
+	p.UserPolicies = userPolicies
+	p.GroupPolicies = groupPolicies
 	p.ServiceRolePolicies = serviceRolePolicies
+	p.AccountManagedPolicyARNs = accountManagedPolicyARNs
 
 	if err = p.compress(); err != nil {
 		return
@@ -208,3 +305,12 @@ func (c *Container) Policy() (_ *Policy, err error, missing []*Attachment) {
 
 	return p, nil, missing
 }
+
+// principalScope tracks, for a single principal, its bare name, which
+// kind of principal it is, and the union of `Scope` prefixes its
+// attachments declared plus the scopes their ManagedPolicyARNs resolve to.
+type principalScope struct {
+	pType PrincipalType
+	name  string
+	scope map[string]bool
+}
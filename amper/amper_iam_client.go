@@ -0,0 +1,90 @@
+package amper
+
+import "context"
+
+// AttachedPolicy mirrors the fields amper needs out of an AWS managed or
+// customer-managed policy attachment.
+type AttachedPolicy struct {
+	PolicyName string
+	PolicyArn  string
+}
+
+// AttachedPoliciesPage is one page of a ListAttached*Policies call.
+type AttachedPoliciesPage struct {
+	Policies    []AttachedPolicy
+	Marker      string
+	IsTruncated bool
+}
+
+// InlinePoliciesPage is one page of a ListRolePolicies call.
+type InlinePoliciesPage struct {
+	PolicyNames []string
+	Marker      string
+	IsTruncated bool
+}
+
+// IAMClient is the narrow AWS IAM boundary amper needs to reconcile the
+// attachments it manages against what is actually attached to a
+// principal in AWS. Its methods take plain names and pagination markers
+// rather than the AWS SDK's request structs, so the SDK's iam.Client
+// needs a thin adapter to satisfy it; tests use a fake implementation.
+//
+// IAMClient has no role-lifecycle calls (CreateRole, GetRole, and the
+// like), so Reconcile can enumerate a role's managed-policy attachments
+// and inline policies, but it has no way to read back a role's trust
+// policy to compare it against a rendered ServiceRole; service-role drift
+// is out of scope until that surface is added.
+type IAMClient interface {
+	ListAttachedRolePolicies(ctx context.Context, roleName, marker string) (AttachedPoliciesPage, error)
+	ListAttachedUserPolicies(ctx context.Context, userName, marker string) (AttachedPoliciesPage, error)
+	ListAttachedGroupPolicies(ctx context.Context, groupName, marker string) (AttachedPoliciesPage, error)
+
+	DetachRolePolicy(ctx context.Context, roleName, policyArn string) error
+	DetachUserPolicy(ctx context.Context, userName, policyArn string) error
+	DetachGroupPolicy(ctx context.Context, groupName, policyArn string) error
+
+	ListRolePolicies(ctx context.Context, roleName, marker string) (InlinePoliciesPage, error)
+	DeleteRolePolicy(ctx context.Context, roleName, policyName string) error
+}
+
+func listAllAttachedPolicies(list func(marker string) (AttachedPoliciesPage, error)) ([]AttachedPolicy, error) {
+	var policies []AttachedPolicy
+	marker := ""
+
+	for {
+		page, err := list(marker)
+
+		if err != nil {
+			return nil, err
+		}
+
+		policies = append(policies, page.Policies...)
+
+		if !page.IsTruncated {
+			return policies, nil
+		}
+
+		marker = page.Marker
+	}
+}
+
+func listAllInlinePolicyNames(list func(marker string) (InlinePoliciesPage, error)) ([]string, error) {
+	var names []string
+	marker := ""
+
+	for {
+		page, err := list(marker)
+
+		if err != nil {
+			return nil, err
+		}
+
+		names = append(names, page.PolicyNames...)
+
+		if !page.IsTruncated {
+			return names, nil
+		}
+
+		marker = page.Marker
+	}
+}
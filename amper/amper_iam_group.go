@@ -0,0 +1,19 @@
+package amper
+
+// IAMGroup is an IAM group that policy templates can be attached to
+// directly.
+type IAMGroup struct {
+	Name string
+}
+
+func (g *IAMGroup) PrincipalName() string {
+	return g.Name
+}
+
+func (g *IAMGroup) PrincipalType() PrincipalType {
+	return PrincipalGroup
+}
+
+func (g *IAMGroup) String() string {
+	return g.Name
+}
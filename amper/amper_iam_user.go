@@ -0,0 +1,19 @@
+package amper
+
+// IAMUser is an IAM user that policy templates can be attached to
+// directly, without a role in between.
+type IAMUser struct {
+	Name string
+}
+
+func (u *IAMUser) PrincipalName() string {
+	return u.Name
+}
+
+func (u *IAMUser) PrincipalType() PrincipalType {
+	return PrincipalUser
+}
+
+func (u *IAMUser) String() string {
+	return u.Name
+}
@@ -0,0 +1,194 @@
+package amper
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/igorzg/terraform-provider-amper/retry"
+)
+
+// Kernel is the root of the amper object graph. It owns the registry of
+// accounts and policy templates shared by every Container, and guards
+// them with a single RWMutex so containers can be built and rendered
+// concurrently.
+type Kernel struct {
+	sync.RWMutex
+
+	accounts        map[string]*Account
+	iamUsers        map[string]*IAMUser
+	iamGroups       map[string]*IAMGroup
+	policyTemplates map[string]*PolicyTemplate
+
+	iam        IAMClient
+	validators []PolicyValidator
+
+	managedPolicyScopeResolver ManagedPolicyScopeResolver
+
+	// RetryPolicy governs how Container.Reconcile retries a failing
+	// list/detach/delete IAM call.
+	RetryPolicy retry.Policy
+
+	// RetryableIAMError decides whether a given error from an IAM call
+	// should be retried under RetryPolicy. Defaults to
+	// DefaultIsRetryableIAMError; callers can widen it.
+	RetryableIAMError retry.IsRetryableFunc
+
+	// MaxPolicySize is the per-document byte budget Policy.compress
+	// bin-packs merged statements under. Defaults to
+	// DefaultMaxPolicySize, IAM's managed-policy limit; raise it to
+	// IAM's larger role-policy limit via WithMaxPolicySize when every
+	// consumer is a role.
+	MaxPolicySize int
+
+	// ActionCatalog decides whether a statement's Actions for a service
+	// are complete enough for Policy.compress to collapse them to
+	// "<service>:*". Defaults to DefaultActionCatalog.
+	ActionCatalog ActionCatalog
+
+	// CollapseActionWildcards toggles whether Policy.compress collapses
+	// statements to service wildcards at all. Defaults to true.
+	CollapseActionWildcards bool
+}
+
+// KernelOption customizes a Kernel at construction time.
+type KernelOption func(*Kernel)
+
+// WithManagedPolicyScopeResolver overrides the resolver used to map a
+// PolicyTemplate's ManagedPolicyARNs to scopes. It defaults to
+// DefaultManagedPolicyScopes.
+func WithManagedPolicyScopeResolver(r ManagedPolicyScopeResolver) KernelOption {
+	return func(k *Kernel) {
+		k.managedPolicyScopeResolver = r
+	}
+}
+
+// WithMaxPolicySize overrides Kernel.MaxPolicySize.
+func WithMaxPolicySize(n int) KernelOption {
+	return func(k *Kernel) {
+		k.MaxPolicySize = n
+	}
+}
+
+// WithActionCatalog overrides Kernel.ActionCatalog.
+func WithActionCatalog(c ActionCatalog) KernelOption {
+	return func(k *Kernel) {
+		k.ActionCatalog = c
+	}
+}
+
+// WithActionWildcardCollapse overrides Kernel.CollapseActionWildcards.
+func WithActionWildcardCollapse(enabled bool) KernelOption {
+	return func(k *Kernel) {
+		k.CollapseActionWildcards = enabled
+	}
+}
+
+// NewKernel returns an empty Kernel ready to have accounts, policy
+// templates and containers registered on it.
+func NewKernel(opts ...KernelOption) *Kernel {
+	k := &Kernel{
+		accounts:                   make(map[string]*Account),
+		iamUsers:                   make(map[string]*IAMUser),
+		iamGroups:                  make(map[string]*IAMGroup),
+		policyTemplates:            make(map[string]*PolicyTemplate),
+		managedPolicyScopeResolver: DefaultManagedPolicyScopes,
+		RetryPolicy:                retry.DefaultPolicy,
+		RetryableIAMError:          DefaultIsRetryableIAMError,
+		MaxPolicySize:              DefaultMaxPolicySize,
+		ActionCatalog:              DefaultActionCatalog,
+		CollapseActionWildcards:    true,
+	}
+
+	for _, opt := range opts {
+		opt(k)
+	}
+
+	return k
+}
+
+// AddAccount registers an account by name so it can later be referenced
+// from Container.AddAttachment.
+func (k *Kernel) AddAccount(a *Account) error {
+	k.Lock()
+	defer k.Unlock()
+
+	if _, ok := k.accounts[a.Name]; ok {
+		return fmt.Errorf("account '%s' already exists", a.Name)
+	}
+
+	k.accounts[a.Name] = a
+
+	return nil
+}
+
+// AddIAMUser registers an IAM user principal by name so it can later be
+// referenced from Container.AddAttachment.
+func (k *Kernel) AddIAMUser(u *IAMUser) error {
+	k.Lock()
+	defer k.Unlock()
+
+	if _, ok := k.iamUsers[u.Name]; ok {
+		return fmt.Errorf("iam user '%s' already exists", u.Name)
+	}
+
+	k.iamUsers[u.Name] = u
+
+	return nil
+}
+
+// AddIAMGroup registers an IAM group principal by name so it can later
+// be referenced from Container.AddAttachment.
+func (k *Kernel) AddIAMGroup(g *IAMGroup) error {
+	k.Lock()
+	defer k.Unlock()
+
+	if _, ok := k.iamGroups[g.Name]; ok {
+		return fmt.Errorf("iam group '%s' already exists", g.Name)
+	}
+
+	k.iamGroups[g.Name] = g
+
+	return nil
+}
+
+// lookupPrincipal resolves a (type, name) pair registered on the kernel
+// to its Principal. Callers must hold at least a read lock on k.
+func (k *Kernel) lookupPrincipal(pType PrincipalType, name string) (Principal, error) {
+	switch pType {
+	case PrincipalRole:
+		if a, ok := k.accounts[name]; ok {
+			return a, nil
+		}
+
+		return nil, fmt.Errorf("unknown account '%s'", name)
+	case PrincipalUser:
+		if u, ok := k.iamUsers[name]; ok {
+			return u, nil
+		}
+
+		return nil, fmt.Errorf("unknown iam user '%s'", name)
+	case PrincipalGroup:
+		if g, ok := k.iamGroups[name]; ok {
+			return g, nil
+		}
+
+		return nil, fmt.Errorf("unknown iam group '%s'", name)
+	default:
+		return nil, fmt.Errorf("unknown principal type '%s'", pType)
+	}
+}
+
+// NewContainer creates a Container bound to this Kernel.
+func (k *Kernel) NewContainer(id string) *Container {
+	return &Container{amper: k, ID: id}
+}
+
+// SetIAMClient wires the AWS IAM boundary used by Container.Reconcile. It
+// is nil by default, in which case Reconcile on an exclusive container
+// returns an error.
+func (k *Kernel) SetIAMClient(c IAMClient) {
+	k.Lock()
+	defer k.Unlock()
+
+	k.iam = c
+}
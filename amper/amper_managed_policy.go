@@ -0,0 +1,44 @@
+package amper
+
+// ManagedPolicyScopeResolver maps an AWS managed policy ARN to the set
+// of scope prefixes (in the same "service:*" shape as PolicyTemplate.Scope)
+// it covers, so actions it grants can still participate in the
+// DenyUnknownServices allowlist instead of being silently blocked by the
+// synthesized deny.
+type ManagedPolicyScopeResolver interface {
+	ResolveScopes(arn string) []string
+}
+
+// ManagedPolicyScopeResolverFunc adapts a plain function to a
+// ManagedPolicyScopeResolver.
+type ManagedPolicyScopeResolverFunc func(arn string) []string
+
+func (f ManagedPolicyScopeResolverFunc) ResolveScopes(arn string) []string {
+	return f(arn)
+}
+
+// DefaultManagedPolicyScopes resolves a handful of common AWS-managed
+// policies. It's conservative: an ARN it doesn't recognize resolves to
+// no scopes, which means its actions will still be denied by
+// DenyUnknownServices unless the caller supplies a wider resolver via
+// WithManagedPolicyScopeResolver.
+var DefaultManagedPolicyScopes ManagedPolicyScopeResolver = ManagedPolicyScopeResolverFunc(func(arn string) []string {
+	switch arn {
+	case "arn:aws:iam::aws:policy/AdministratorAccess":
+		return []string{"*"}
+	case "arn:aws:iam::aws:policy/ReadOnlyAccess":
+		return []string{"*:Describe*", "*:Get*", "*:List*"}
+	case "arn:aws:iam::aws:policy/job-function/Billing":
+		return []string{"aws-portal:*", "budgets:*", "ce:*"}
+	case "arn:aws:iam::aws:policy/job-function/DatabaseAdministrator":
+		return []string{"rds:*", "dynamodb:*", "dax:*", "elasticache:*", "redshift:*"}
+	case "arn:aws:iam::aws:policy/job-function/NetworkAdministrator":
+		return []string{"ec2:*", "elasticloadbalancing:*", "route53:*", "cloudfront:*", "directconnect:*"}
+	case "arn:aws:iam::aws:policy/job-function/SupportUser":
+		return []string{"support:*"}
+	case "arn:aws:iam::aws:policy/job-function/SystemAdministrator":
+		return []string{"ec2:*", "autoscaling:*", "cloudwatch:*", "s3:*"}
+	default:
+		return nil
+	}
+})
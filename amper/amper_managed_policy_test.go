@@ -0,0 +1,100 @@
+package amper
+
+import "testing"
+
+func TestPolicy_ManagedPolicyARNsParticipateInScope(t *testing.T) {
+	k := NewKernel()
+
+	if err := k.AddAccount(&Account{Name: "deploy-role"}); err != nil {
+		t.Fatalf("AddAccount: %v", err)
+	}
+
+	c := k.NewContainer("test")
+
+	pt := &PolicyTemplate{
+		Key:               "read-only",
+		ManagedPolicyARNs: []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"},
+		DocumentJSON:      `{"Version":"2012-10-17","Statement":[{"Sid":"AllowGet","Effect":"Allow","Action":["s3:GetObject"],"Resource":["*"]}]}`,
+	}
+
+	if err := c.AddPolicyTemplate(pt); err != nil {
+		t.Fatalf("AddPolicyTemplate: %v", err)
+	}
+
+	if _, err := c.AddAttachment("read-only", PrincipalRole, "deploy-role", nil); err != nil {
+		t.Fatalf("AddAttachment: %v", err)
+	}
+
+	p, err, missing := c.Policy()
+
+	if err != nil {
+		t.Fatalf("Policy: %v", err)
+	}
+
+	if len(missing) != 0 {
+		t.Fatalf("expected no missing attachments, got %+v", missing)
+	}
+
+	arns := p.AccountManagedPolicyARNs["role:deploy-role"]
+
+	if len(arns) != 1 || arns[0] != "arn:aws:iam::aws:policy/ReadOnlyAccess" {
+		t.Fatalf("expected ReadOnlyAccess in AccountManagedPolicyARNs, got %+v", arns)
+	}
+
+	accountPolicies := p.AccountPolicies["deploy-role"]
+
+	var denyUnknown *IAMPolicyStatement
+
+	for _, doc := range accountPolicies {
+		for _, s := range doc.Statements {
+			if s.Sid == "DenyUnknownServices" {
+				denyUnknown = s
+			}
+		}
+	}
+
+	if denyUnknown == nil {
+		t.Fatal("expected a DenyUnknownServices statement")
+	}
+
+	if !containsString(denyUnknown.NotActions, "*:Get*") {
+		t.Fatalf("expected ReadOnlyAccess's resolved scope to be allowlisted, got %+v", denyUnknown.NotActions)
+	}
+}
+
+func TestPolicy_ManagedPolicyARNsRenderVars(t *testing.T) {
+	k := NewKernel()
+
+	if err := k.AddAccount(&Account{Name: "deploy-role"}); err != nil {
+		t.Fatalf("AddAccount: %v", err)
+	}
+
+	c := k.NewContainer("test")
+
+	pt := &PolicyTemplate{
+		Key:               "by-var",
+		Vars:              []string{"Suffix"},
+		ManagedPolicyARNs: []string{"arn:aws:iam::aws:policy/job-function/{{.Vars.Suffix}}"},
+		DocumentJSON:      `{"Version":"2012-10-17","Statement":[{"Sid":"AllowGet","Effect":"Allow","Action":["support:CreateCase"],"Resource":["*"]}]}`,
+	}
+
+	if err := c.AddPolicyTemplate(pt); err != nil {
+		t.Fatalf("AddPolicyTemplate: %v", err)
+	}
+
+	if _, err := c.AddAttachment("by-var", PrincipalRole, "deploy-role", map[string]string{"Suffix": "SupportUser"}); err != nil {
+		t.Fatalf("AddAttachment: %v", err)
+	}
+
+	p, err, _ := c.Policy()
+
+	if err != nil {
+		t.Fatalf("Policy: %v", err)
+	}
+
+	arns := p.AccountManagedPolicyARNs["role:deploy-role"]
+
+	if len(arns) != 1 || arns[0] != "arn:aws:iam::aws:policy/job-function/SupportUser" {
+		t.Fatalf("expected the ARN template to render with Vars, got %+v", arns)
+	}
+}
@@ -0,0 +1,63 @@
+package amper
+
+import "encoding/json"
+
+// IAMPolicyVersion is the only IAM policy language version amper emits.
+const IAMPolicyVersion = "2012-10-17"
+
+// IAMPolicyStatement is a single statement of an IAM policy document.
+type IAMPolicyStatement struct {
+	Sid        string                            `json:"Sid,omitempty"`
+	Effect     string                            `json:"Effect"`
+	Actions    []string                          `json:"Action,omitempty"`
+	NotActions []string                          `json:"NotAction,omitempty"`
+	Resources  []string                          `json:"Resource,omitempty"`
+	Principals map[string][]string               `json:"Principal,omitempty"`
+	Conditions map[string]map[string]interface{} `json:"Condition,omitempty"`
+}
+
+// IAMPolicyDoc is a rendered IAM policy document.
+type IAMPolicyDoc struct {
+	Version    string                `json:"Version,omitempty"`
+	Statements []*IAMPolicyStatement `json:"Statement,omitempty"`
+}
+
+func unmarshalIAMPolicyDoc(b []byte) (*IAMPolicyDoc, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+
+	doc := &IAMPolicyDoc{}
+
+	if err := json.Unmarshal(b, doc); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// ServiceRolePolicy pairs the inline policy of a service-linked role with
+// its assume-role policy.
+type ServiceRolePolicy struct {
+	Policy           *IAMPolicyDoc
+	AssumeRolePolicy *IAMPolicyDoc
+}
+
+// Policy is the merged, per-account output of Container.Policy().
+//
+// AccountPolicies, AccountRolePolicies, UserPolicies and GroupPolicies are
+// each already segregated by principal type, so they're keyed by bare
+// principal name. ServiceRolePolicies and AccountManagedPolicyARNs span
+// every principal type in one map, so they're keyed by
+// "<PrincipalType>:<PrincipalName>" to avoid a role and a user (or group)
+// that share a name colliding.
+type Policy struct {
+	amper *Kernel
+
+	AccountPolicies          map[string][]*IAMPolicyDoc
+	AccountRolePolicies      map[string][]*IAMPolicyDoc
+	UserPolicies             map[string][]*IAMPolicyDoc
+	GroupPolicies            map[string][]*IAMPolicyDoc
+	ServiceRolePolicies      map[string]map[string]*ServiceRolePolicy
+	AccountManagedPolicyARNs map[string][]string
+}
@@ -0,0 +1,370 @@
+package amper
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultMaxPolicySize is IAM's managed-policy character limit. It's the
+// conservative default for Kernel.MaxPolicySize; consumers whose
+// policies only ever attach to roles can raise it to IAM's larger
+// inline role-policy limit (10,240) via WithMaxPolicySize.
+const DefaultMaxPolicySize = 6144
+
+// ActionCatalog answers whether a set of actions observed for a single
+// AWS service statement is every action that service exposes, so
+// Policy.compress can collapse them to a single "<service>:*" action
+// instead of listing each one individually.
+type ActionCatalog interface {
+	IsServiceComplete(service string, actions []string) bool
+}
+
+// ActionCatalogFunc adapts a plain function to an ActionCatalog.
+type ActionCatalogFunc func(service string, actions []string) bool
+
+func (f ActionCatalogFunc) IsServiceComplete(service string, actions []string) bool {
+	return f(service, actions)
+}
+
+// DefaultActionCatalog knows the full action set for a small, curated
+// list of services. Like DefaultManagedPolicyScopes, it's conservative:
+// a service it doesn't recognize never collapses. Consumers with a
+// wider need should supply their own ActionCatalog via
+// WithActionCatalog rather than rely on this list growing.
+var DefaultActionCatalog ActionCatalog = ActionCatalogFunc(func(service string, actions []string) bool {
+	full, ok := builtinServiceActions[service]
+
+	if !ok || len(actions) != len(full) {
+		return false
+	}
+
+	for _, a := range actions {
+		if !full[a] {
+			return false
+		}
+	}
+
+	return true
+})
+
+var builtinServiceActions = map[string]map[string]bool{
+	"s3": stringSet(
+		"s3:GetObject", "s3:PutObject", "s3:DeleteObject",
+		"s3:ListBucket", "s3:GetBucketLocation",
+	),
+	"sts": stringSet("sts:AssumeRole", "sts:GetCallerIdentity"),
+}
+
+func stringSet(vals ...string) map[string]bool {
+	m := make(map[string]bool, len(vals))
+
+	for _, v := range vals {
+		m[v] = true
+	}
+
+	return m
+}
+
+// compress canonicalizes every statement amper rendered for each
+// principal, merges the ones that only differ by Action (statements with
+// different Resources are never merged),
+// optionally collapses a statement's actions down to a service wildcard,
+// then bin-packs the result into as many IAMPolicyDocs as it takes to
+// stay under the Kernel's MaxPolicySize.
+func (p *Policy) compress() error {
+	maxSize := DefaultMaxPolicySize
+	var catalog ActionCatalog
+	collapse := true
+
+	if p.amper != nil {
+		if p.amper.MaxPolicySize > 0 {
+			maxSize = p.amper.MaxPolicySize
+		}
+
+		catalog = p.amper.ActionCatalog
+		collapse = p.amper.CollapseActionWildcards
+	}
+
+	for _, docs := range []map[string][]*IAMPolicyDoc{p.AccountPolicies, p.AccountRolePolicies, p.UserPolicies, p.GroupPolicies} {
+		for name, perName := range docs {
+			merged := mergeStatements(flattenStatements(perName))
+
+			if collapse && catalog != nil {
+				collapseActionWildcards(merged, catalog)
+			}
+
+			packed, err := binPackStatements(merged, maxSize)
+
+			if err != nil {
+				return fmt.Errorf("cannot compress policy for '%s': %w", name, err)
+			}
+
+			docs[name] = packed
+		}
+	}
+
+	return nil
+}
+
+func flattenStatements(docs []*IAMPolicyDoc) []*IAMPolicyStatement {
+	var stmts []*IAMPolicyStatement
+
+	for _, d := range docs {
+		if d != nil {
+			stmts = append(stmts, d.Statements...)
+		}
+	}
+
+	return stmts
+}
+
+// mergeStatements canonicalizes every statement (sorting its Actions,
+// Resources, Principals and Conditions) and unions the Actions of
+// statements that share an Effect, Principal, Condition and Resources, in
+// the order each distinct group was first seen. Resources must match
+// exactly for two statements to merge; otherwise unioning their Actions
+// would grant the cross product of both statements' actions over both
+// statements' resources.
+func mergeStatements(stmts []*IAMPolicyStatement) []*IAMPolicyStatement {
+	order := make([]string, 0, len(stmts))
+	groups := make(map[string]*IAMPolicyStatement, len(stmts))
+
+	for _, s := range stmts {
+		c := canonicalizeStatement(s)
+		key := statementMergeKey(c)
+
+		existing, ok := groups[key]
+
+		if !ok {
+			groups[key] = c
+			order = append(order, key)
+			continue
+		}
+
+		existing.Actions = sortedUniqueStrings(append(existing.Actions, c.Actions...))
+		existing.NotActions = sortedUniqueStrings(append(existing.NotActions, c.NotActions...))
+	}
+
+	merged := make([]*IAMPolicyStatement, len(order))
+
+	for i, key := range order {
+		merged[i] = groups[key]
+	}
+
+	return merged
+}
+
+func statementMergeKey(c *IAMPolicyStatement) string {
+	principalsJSON, _ := json.Marshal(c.Principals)
+	conditionsJSON, _ := json.Marshal(c.Conditions)
+	resourcesJSON, _ := json.Marshal(c.Resources)
+
+	actionKind := "action"
+
+	if len(c.NotActions) > 0 {
+		actionKind = "not-action"
+	}
+
+	return c.Effect + "|" + actionKind + "|" + string(principalsJSON) + "|" + string(conditionsJSON) + "|" + string(resourcesJSON)
+}
+
+func canonicalizeStatement(s *IAMPolicyStatement) *IAMPolicyStatement {
+	c := &IAMPolicyStatement{
+		Sid:        s.Sid,
+		Effect:     s.Effect,
+		Actions:    sortedUniqueStrings(s.Actions),
+		NotActions: sortedUniqueStrings(s.NotActions),
+		Resources:  sortedUniqueStrings(s.Resources),
+	}
+
+	if len(s.Principals) > 0 {
+		c.Principals = make(map[string][]string, len(s.Principals))
+
+		for k, v := range s.Principals {
+			c.Principals[k] = sortedUniqueStrings(v)
+		}
+	}
+
+	if len(s.Conditions) > 0 {
+		c.Conditions = make(map[string]map[string]interface{}, len(s.Conditions))
+
+		for op, kv := range s.Conditions {
+			canon := make(map[string]interface{}, len(kv))
+
+			for k, v := range kv {
+				canon[k] = canonicalizeConditionValue(v)
+			}
+
+			c.Conditions[op] = canon
+		}
+	}
+
+	return c
+}
+
+// canonicalizeConditionValue sorts a condition operator's value when it
+// is a list of strings; IAM treats these lists as sets, so sorting them
+// keeps conditions that only differ by list order grouped together.
+func canonicalizeConditionValue(v interface{}) interface{} {
+	list, ok := v.([]interface{})
+
+	if !ok {
+		return v
+	}
+
+	strs := make([]string, 0, len(list))
+
+	for _, e := range list {
+		s, ok := e.(string)
+
+		if !ok {
+			return v
+		}
+
+		strs = append(strs, s)
+	}
+
+	sort.Strings(strs)
+
+	out := make([]interface{}, len(strs))
+
+	for i, s := range strs {
+		out[i] = s
+	}
+
+	return out
+}
+
+func sortedUniqueStrings(in []string) []string {
+	if len(in) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool, len(in))
+	out := make([]string, 0, len(in))
+
+	for _, s := range in {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+
+	sort.Strings(out)
+
+	return out
+}
+
+// collapseActionWildcards replaces a statement's Actions for a service
+// with "<service>:*" when catalog reports that the statement already
+// grants every action that service exposes.
+func collapseActionWildcards(stmts []*IAMPolicyStatement, catalog ActionCatalog) {
+	for _, s := range stmts {
+		if len(s.Actions) == 0 || containsWildcardAction(s.Actions) {
+			continue
+		}
+
+		byService := make(map[string][]string)
+
+		for _, a := range s.Actions {
+			svc, _, _ := strings.Cut(a, ":")
+			byService[svc] = append(byService[svc], a)
+		}
+
+		collapsedServices := make(map[string]bool)
+
+		for svc, actions := range byService {
+			if catalog.IsServiceComplete(svc, actions) {
+				collapsedServices[svc] = true
+			}
+		}
+
+		if len(collapsedServices) == 0 {
+			continue
+		}
+
+		kept := make([]string, 0, len(s.Actions))
+
+		for svc := range collapsedServices {
+			kept = append(kept, svc+":*")
+		}
+
+		for _, a := range s.Actions {
+			svc, _, _ := strings.Cut(a, ":")
+
+			if !collapsedServices[svc] {
+				kept = append(kept, a)
+			}
+		}
+
+		s.Actions = sortedUniqueStrings(kept)
+	}
+}
+
+func containsWildcardAction(actions []string) bool {
+	for _, a := range actions {
+		if a == "*" || strings.HasSuffix(a, ":*") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// binPackStatements greedily first-fits each statement into the
+// smallest-indexed existing IAMPolicyDoc it fits under maxSize bytes of
+// rendered JSON, opening a new doc when none does. A single statement
+// that alone exceeds maxSize is an error: compress has no way to split a
+// statement further.
+func binPackStatements(stmts []*IAMPolicyStatement, maxSize int) ([]*IAMPolicyDoc, error) {
+	var docs []*IAMPolicyDoc
+
+	for _, s := range stmts {
+		placed := false
+
+		for _, d := range docs {
+			candidate := append(append([]*IAMPolicyStatement{}, d.Statements...), s)
+			size, err := policyDocSize(candidate)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if size <= maxSize {
+				d.Statements = candidate
+				placed = true
+				break
+			}
+		}
+
+		if placed {
+			continue
+		}
+
+		size, err := policyDocSize([]*IAMPolicyStatement{s})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if size > maxSize {
+			return nil, fmt.Errorf("statement '%s' alone serializes to %d bytes, over the %d byte policy size budget", s.Sid, size, maxSize)
+		}
+
+		docs = append(docs, &IAMPolicyDoc{Version: IAMPolicyVersion, Statements: []*IAMPolicyStatement{s}})
+	}
+
+	return docs, nil
+}
+
+func policyDocSize(stmts []*IAMPolicyStatement) (int, error) {
+	b, err := json.Marshal(&IAMPolicyDoc{Version: IAMPolicyVersion, Statements: stmts})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
@@ -0,0 +1,239 @@
+package amper
+
+import "testing"
+
+func TestMergeStatements_UnionsSameEffectPrincipalConditionResources(t *testing.T) {
+	stmts := []*IAMPolicyStatement{
+		{Sid: "A", Effect: "Allow", Actions: []string{"s3:PutObject"}, Resources: []string{"arn:aws:s3:::b/1"}},
+		{Sid: "B", Effect: "Allow", Actions: []string{"s3:GetObject"}, Resources: []string{"arn:aws:s3:::b/1"}},
+		{Sid: "C", Effect: "Deny", Actions: []string{"s3:DeleteObject"}, Resources: []string{"*"}},
+	}
+
+	merged := mergeStatements(stmts)
+
+	if len(merged) != 2 {
+		t.Fatalf("expected the two Allow statements to merge into one, got %d statements: %+v", len(merged), merged)
+	}
+
+	var allow *IAMPolicyStatement
+
+	for _, s := range merged {
+		if s.Effect == "Allow" {
+			allow = s
+		}
+	}
+
+	if allow == nil {
+		t.Fatal("expected a merged Allow statement")
+	}
+
+	wantActions := []string{"s3:GetObject", "s3:PutObject"}
+
+	if len(allow.Actions) != len(wantActions) || allow.Actions[0] != wantActions[0] || allow.Actions[1] != wantActions[1] {
+		t.Fatalf("expected sorted union of actions %v, got %v", wantActions, allow.Actions)
+	}
+
+	if len(allow.Resources) != 1 || allow.Resources[0] != "arn:aws:s3:::b/1" {
+		t.Fatalf("expected the merged statement's resources to stay exactly arn:aws:s3:::b/1, got %v", allow.Resources)
+	}
+}
+
+// TestMergeStatements_DoesNotWidenResourcesAcrossDifferentActions covers a
+// past bug where two Allow statements granting different actions on
+// different resources were merged by Effect/Principal/Condition alone,
+// unioning Actions and Resources in the same pass and silently granting
+// the cross product of both statements' actions over both statements'
+// resources.
+func TestMergeStatements_DoesNotWidenResourcesAcrossDifferentActions(t *testing.T) {
+	stmts := []*IAMPolicyStatement{
+		{Sid: "A", Effect: "Allow", Actions: []string{"s3:PutObject"}, Resources: []string{"arn:aws:s3:::b/2"}},
+		{Sid: "B", Effect: "Allow", Actions: []string{"s3:GetObject"}, Resources: []string{"arn:aws:s3:::b/1"}},
+	}
+
+	merged := mergeStatements(stmts)
+
+	if len(merged) != 2 {
+		t.Fatalf("expected statements with different resources to stay separate, got %d statements: %+v", len(merged), merged)
+	}
+
+	for _, s := range merged {
+		for _, action := range s.Actions {
+			for _, resource := range s.Resources {
+				if action == "s3:PutObject" && resource == "arn:aws:s3:::b/1" {
+					t.Fatalf("merge must not grant PutObject on b/1, which no input statement authorized: %+v", merged)
+				}
+
+				if action == "s3:GetObject" && resource == "arn:aws:s3:::b/2" {
+					t.Fatalf("merge must not grant GetObject on b/2, which no input statement authorized: %+v", merged)
+				}
+			}
+		}
+	}
+}
+
+func TestMergeStatements_DoesNotMergeAcrossDifferentPrincipals(t *testing.T) {
+	stmts := []*IAMPolicyStatement{
+		{Effect: "Allow", Actions: []string{"s3:GetObject"}, Principals: map[string][]string{"AWS": {"arn:aws:iam::111122223333:root"}}},
+		{Effect: "Allow", Actions: []string{"s3:GetObject"}, Principals: map[string][]string{"AWS": {"arn:aws:iam::444455556666:root"}}},
+	}
+
+	merged := mergeStatements(stmts)
+
+	if len(merged) != 2 {
+		t.Fatalf("expected statements with distinct principals to stay separate, got %d", len(merged))
+	}
+}
+
+func TestMergeStatements_IsDeterministicRegardlessOfInputOrder(t *testing.T) {
+	forward := []*IAMPolicyStatement{
+		{Effect: "Allow", Actions: []string{"s3:PutObject"}},
+		{Effect: "Allow", Actions: []string{"s3:GetObject"}},
+	}
+
+	reversed := []*IAMPolicyStatement{
+		{Effect: "Allow", Actions: []string{"s3:GetObject"}},
+		{Effect: "Allow", Actions: []string{"s3:PutObject"}},
+	}
+
+	a := mergeStatements(forward)
+	b := mergeStatements(reversed)
+
+	if len(a) != 1 || len(b) != 1 {
+		t.Fatalf("expected both orderings to merge to a single statement, got %d and %d", len(a), len(b))
+	}
+
+	if len(a[0].Actions) != 2 || a[0].Actions[0] != b[0].Actions[0] || a[0].Actions[1] != b[0].Actions[1] {
+		t.Fatalf("expected canonicalization to make merged Actions order-independent, got %v vs %v", a[0].Actions, b[0].Actions)
+	}
+}
+
+func TestCollapseActionWildcards_CollapsesCompleteServiceActionSet(t *testing.T) {
+	catalog := ActionCatalogFunc(func(service string, actions []string) bool {
+		return service == "sts" && len(actions) == 2
+	})
+
+	stmts := []*IAMPolicyStatement{
+		{Effect: "Allow", Actions: []string{"sts:AssumeRole", "sts:GetCallerIdentity"}},
+	}
+
+	collapseActionWildcards(stmts, catalog)
+
+	if len(stmts[0].Actions) != 1 || stmts[0].Actions[0] != "sts:*" {
+		t.Fatalf("expected a complete sts action set to collapse to sts:*, got %+v", stmts[0].Actions)
+	}
+}
+
+func TestCollapseActionWildcards_LeavesIncompleteServiceActionSetAlone(t *testing.T) {
+	stmts := []*IAMPolicyStatement{
+		{Effect: "Allow", Actions: []string{"s3:GetObject"}},
+	}
+
+	collapseActionWildcards(stmts, DefaultActionCatalog)
+
+	if len(stmts[0].Actions) != 1 || stmts[0].Actions[0] != "s3:GetObject" {
+		t.Fatalf("expected a partial action set not to collapse, got %+v", stmts[0].Actions)
+	}
+}
+
+func TestBinPackStatements_SplitsAtSizeBoundary(t *testing.T) {
+	stmts := []*IAMPolicyStatement{
+		{Sid: "One", Effect: "Allow", Actions: []string{"s3:GetObject"}, Resources: []string{"*"}},
+		{Sid: "Two", Effect: "Allow", Actions: []string{"s3:PutObject"}, Resources: []string{"*"}},
+	}
+
+	oneDocSize, err := policyDocSize(stmts)
+
+	if err != nil {
+		t.Fatalf("policyDocSize: %v", err)
+	}
+
+	docs, err := binPackStatements(stmts, oneDocSize)
+
+	if err != nil {
+		t.Fatalf("binPackStatements: %v", err)
+	}
+
+	if len(docs) != 1 {
+		t.Fatalf("expected both statements to fit in one doc at the exact boundary, got %d docs", len(docs))
+	}
+
+	docs, err = binPackStatements(stmts, oneDocSize-1)
+
+	if err != nil {
+		t.Fatalf("binPackStatements: %v", err)
+	}
+
+	if len(docs) != 2 {
+		t.Fatalf("expected the statements to split into two docs one byte under the boundary, got %d docs", len(docs))
+	}
+}
+
+func TestBinPackStatements_ErrorsWhenASingleStatementExceedsTheBudget(t *testing.T) {
+	stmts := []*IAMPolicyStatement{
+		{Sid: "TooBig", Effect: "Allow", Actions: []string{"s3:GetObject"}, Resources: []string{"*"}},
+	}
+
+	if _, err := binPackStatements(stmts, 1); err == nil {
+		t.Fatal("expected an error when a single statement can't fit under the size budget")
+	}
+}
+
+func TestPolicy_CompressBinPacksAcrossMultipleDocsUnderMaxPolicySize(t *testing.T) {
+	k := NewKernel(WithMaxPolicySize(300))
+
+	if err := k.AddAccount(&Account{Name: "svc-role"}); err != nil {
+		t.Fatalf("AddAccount: %v", err)
+	}
+
+	c := k.NewContainer("test")
+
+	// Each statement carries a Condition unique to its service so that
+	// merging (which only unions statements sharing Effect/Principal/
+	// Condition) leaves all five separate, forcing compress to bin-pack
+	// them rather than collapsing everything into one statement.
+	for i, service := range []string{"s3", "dynamodb", "sqs", "sns", "kms"} {
+		pt := &PolicyTemplate{
+			Key:   service,
+			Scope: []string{service + ":*"},
+			DocumentJSON: `{"Version":"2012-10-17","Statement":[{"Sid":"Allow` + service + `","Effect":"Allow",` +
+				`"Action":["` + service + `:DoThing` + string(rune('A'+i)) + `"],"Resource":["*"],` +
+				`"Condition":{"StringEquals":{"aws:RequestedRegion":["region-` + service + `"]}}}]}`,
+		}
+
+		if err := c.AddPolicyTemplate(pt); err != nil {
+			t.Fatalf("AddPolicyTemplate(%s): %v", service, err)
+		}
+
+		if _, err := c.AddAttachment(service, PrincipalRole, "svc-role", nil); err != nil {
+			t.Fatalf("AddAttachment(%s): %v", service, err)
+		}
+	}
+
+	p, err, missing := c.Policy()
+
+	if err != nil {
+		t.Fatalf("Policy: %v", err)
+	}
+
+	if len(missing) != 0 {
+		t.Fatalf("expected no missing attachments, got %+v", missing)
+	}
+
+	docs := p.AccountPolicies["svc-role"]
+
+	if len(docs) < 2 {
+		t.Fatalf("expected compress to split statements across multiple docs under a 300 byte budget, got %d doc(s)", len(docs))
+	}
+
+	for i, doc := range docs {
+		size, err := policyDocSize(doc.Statements)
+
+		if err != nil {
+			t.Fatalf("policyDocSize: %v", err)
+		}
+
+		if size > 300 {
+			t.Fatalf("doc %d serializes to %d bytes, over the 300 byte budget", i, size)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package amper
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// ServiceRole describes the AWS service-linked role a PolicyTemplate may
+// render in addition to its main policy document.
+type ServiceRole struct {
+	Name       string
+	AssumeJSON string
+	PolicyJSON string
+}
+
+// PolicyTemplate is a named, reusable policy document rendered per
+// attachment. Document and AssumeRole/Role templates are Go text
+// templates executed with the attachment's vars.
+type PolicyTemplate struct {
+	Key   string
+	Vars  []string
+	Scope []string
+
+	DocumentJSON string
+	ServiceRole  *ServiceRole
+
+	// ManagedPolicyARNs lists AWS managed policies to attach alongside
+	// the rendered DocumentJSON. Each entry is itself a Go text
+	// template, rendered with the same Principal/Vars data as
+	// DocumentJSON, so an ARN can embed a var (e.g. a partition or
+	// account id).
+	ManagedPolicyARNs []string
+
+	amper     *Kernel
+	container *Container
+}
+
+func (pt *PolicyTemplate) render(doc string, principal Principal, vars map[string]string) (*IAMPolicyDoc, error) {
+	if doc == "" {
+		return nil, nil
+	}
+
+	tpl, err := template.New(pt.Key).Parse(doc)
+
+	if err != nil {
+		return nil, fmt.Errorf("policy template '%s' is invalid: %w", pt.Key, err)
+	}
+
+	data := struct {
+		Principal Principal
+		Vars      map[string]string
+	}{Principal: principal, Vars: vars}
+
+	var buf bytes.Buffer
+
+	if err := tpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("policy template '%s' failed to render: %w", pt.Key, err)
+	}
+
+	return unmarshalIAMPolicyDoc(buf.Bytes())
+}
+
+func (pt *PolicyTemplate) renderTemplate(c *Container, principal Principal, vars map[string]string) (*IAMPolicyDoc, error) {
+	return pt.render(pt.DocumentJSON, principal, vars)
+}
+
+func (pt *PolicyTemplate) renderServiceRole(c *Container, principal Principal, vars map[string]string) (*IAMPolicyDoc, error) {
+	if pt.ServiceRole == nil {
+		return nil, nil
+	}
+
+	return pt.render(pt.ServiceRole.PolicyJSON, principal, vars)
+}
+
+func (pt *PolicyTemplate) renderServiceAssumeRole(c *Container, principal Principal, vars map[string]string) (*IAMPolicyDoc, error) {
+	if pt.ServiceRole == nil {
+		return nil, nil
+	}
+
+	return pt.render(pt.ServiceRole.AssumeJSON, principal, vars)
+}
+
+func (pt *PolicyTemplate) renderManagedPolicyARNs(principal Principal, vars map[string]string) ([]string, error) {
+	if len(pt.ManagedPolicyARNs) == 0 {
+		return nil, nil
+	}
+
+	data := struct {
+		Principal Principal
+		Vars      map[string]string
+	}{Principal: principal, Vars: vars}
+
+	arns := make([]string, len(pt.ManagedPolicyARNs))
+
+	for i, raw := range pt.ManagedPolicyARNs {
+		tpl, err := template.New(pt.Key).Parse(raw)
+
+		if err != nil {
+			return nil, fmt.Errorf("policy template '%s' managed policy ARN #%d is invalid: %w", pt.Key, i, err)
+		}
+
+		var buf bytes.Buffer
+
+		if err := tpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("policy template '%s' managed policy ARN #%d failed to render: %w", pt.Key, i, err)
+		}
+
+		arns[i] = buf.String()
+	}
+
+	return arns, nil
+}
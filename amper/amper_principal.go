@@ -0,0 +1,18 @@
+package amper
+
+// PrincipalType distinguishes the three kinds of IAM principal an
+// attachment can target.
+type PrincipalType string
+
+const (
+	PrincipalRole  PrincipalType = "role"
+	PrincipalUser  PrincipalType = "user"
+	PrincipalGroup PrincipalType = "group"
+)
+
+// Principal is anything a policy template can be attached to: an
+// Account (an IAM role owner), an IAMUser or an IAMGroup.
+type Principal interface {
+	PrincipalName() string
+	PrincipalType() PrincipalType
+}
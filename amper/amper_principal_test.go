@@ -0,0 +1,172 @@
+package amper
+
+import "testing"
+
+func newPrincipalTestKernel(t *testing.T) *Kernel {
+	t.Helper()
+
+	k := NewKernel()
+
+	if err := k.AddAccount(&Account{Name: "deploy-role"}); err != nil {
+		t.Fatalf("AddAccount: %v", err)
+	}
+
+	if err := k.AddIAMUser(&IAMUser{Name: "alice"}); err != nil {
+		t.Fatalf("AddIAMUser: %v", err)
+	}
+
+	if err := k.AddIAMGroup(&IAMGroup{Name: "developers"}); err != nil {
+		t.Fatalf("AddIAMGroup: %v", err)
+	}
+
+	pt := &PolicyTemplate{
+		Key:          "allow-s3",
+		Scope:        []string{"s3:*"},
+		DocumentJSON: `{"Version":"2012-10-17","Statement":[{"Sid":"AllowS3","Effect":"Allow","Action":["s3:GetObject"],"Resource":["*"]}]}`,
+	}
+
+	c := k.NewContainer("test")
+
+	if err := c.AddPolicyTemplate(pt); err != nil {
+		t.Fatalf("AddPolicyTemplate: %v", err)
+	}
+
+	return k
+}
+
+func TestPolicy_PerPrincipalTypeMaps(t *testing.T) {
+	k := newPrincipalTestKernel(t)
+	c := k.policyTemplates["allow-s3"].container
+
+	if _, err := c.AddAttachment("allow-s3", PrincipalRole, "deploy-role", nil); err != nil {
+		t.Fatalf("AddAttachment role: %v", err)
+	}
+
+	if _, err := c.AddAttachment("allow-s3", PrincipalUser, "alice", nil); err != nil {
+		t.Fatalf("AddAttachment user: %v", err)
+	}
+
+	if _, err := c.AddAttachment("allow-s3", PrincipalGroup, "developers", nil); err != nil {
+		t.Fatalf("AddAttachment group: %v", err)
+	}
+
+	p, err, missing := c.Policy()
+
+	if err != nil {
+		t.Fatalf("Policy: %v", err)
+	}
+
+	if len(missing) != 0 {
+		t.Fatalf("expected no missing attachments, got %+v", missing)
+	}
+
+	if _, ok := p.AccountPolicies["deploy-role"]; !ok {
+		t.Fatalf("expected deploy-role in AccountPolicies, got %+v", p.AccountPolicies)
+	}
+
+	if _, ok := p.AccountRolePolicies["deploy-role"]; !ok {
+		t.Fatalf("expected deploy-role in AccountRolePolicies, got %+v", p.AccountRolePolicies)
+	}
+
+	if _, ok := p.UserPolicies["alice"]; !ok {
+		t.Fatalf("expected alice in UserPolicies, got %+v", p.UserPolicies)
+	}
+
+	if _, ok := p.AccountRolePolicies["alice"]; ok {
+		t.Fatalf("iam users must not get an AccountRolePolicies entry, got %+v", p.AccountRolePolicies)
+	}
+
+	if _, ok := p.GroupPolicies["developers"]; !ok {
+		t.Fatalf("expected developers in GroupPolicies, got %+v", p.GroupPolicies)
+	}
+}
+
+func TestPolicy_RoleAndUserSharingANameDoNotShareScope(t *testing.T) {
+	k := NewKernel()
+
+	if err := k.AddAccount(&Account{Name: "alice"}); err != nil {
+		t.Fatalf("AddAccount: %v", err)
+	}
+
+	if err := k.AddIAMUser(&IAMUser{Name: "alice"}); err != nil {
+		t.Fatalf("AddIAMUser: %v", err)
+	}
+
+	c := k.NewContainer("test")
+
+	pt := &PolicyTemplate{
+		Key:          "allow-s3",
+		Scope:        []string{"s3:*"},
+		DocumentJSON: `{"Version":"2012-10-17","Statement":[{"Sid":"AllowS3","Effect":"Allow","Action":["s3:GetObject"],"Resource":["*"]}]}`,
+	}
+
+	if err := c.AddPolicyTemplate(pt); err != nil {
+		t.Fatalf("AddPolicyTemplate: %v", err)
+	}
+
+	if _, err := c.AddAttachment("allow-s3", PrincipalRole, "alice", nil); err != nil {
+		t.Fatalf("AddAttachment role: %v", err)
+	}
+
+	if _, err := c.AddAttachment("allow-s3", PrincipalUser, "alice", nil); err != nil {
+		t.Fatalf("AddAttachment user: %v", err)
+	}
+
+	p, err, missing := c.Policy()
+
+	if err != nil {
+		t.Fatalf("Policy: %v", err)
+	}
+
+	if len(missing) != 0 {
+		t.Fatalf("expected no missing attachments, got %+v", missing)
+	}
+
+	for _, typ := range []string{"role", "user"} {
+		var docs []*IAMPolicyDoc
+
+		if typ == "role" {
+			docs = p.AccountPolicies["alice"]
+		} else {
+			docs = p.UserPolicies["alice"]
+		}
+
+		var denyUnknown *IAMPolicyStatement
+
+		for _, doc := range docs {
+			for _, s := range doc.Statements {
+				if s.Sid == "DenyUnknownServices" || s.Sid == "DenyAll" {
+					denyUnknown = s
+				}
+			}
+		}
+
+		if denyUnknown == nil {
+			t.Fatalf("expected the %s named 'alice' to get its own deny-boundary statement, got %+v", typ, docs)
+		}
+	}
+}
+
+func TestAddAttachment_RejectsServiceRoleOnNonRolePrincipal(t *testing.T) {
+	k := NewKernel()
+
+	if err := k.AddIAMUser(&IAMUser{Name: "alice"}); err != nil {
+		t.Fatalf("AddIAMUser: %v", err)
+	}
+
+	c := k.NewContainer("test")
+
+	pt := &PolicyTemplate{
+		Key:          "assume-role",
+		DocumentJSON: `{"Version":"2012-10-17","Statement":[]}`,
+		ServiceRole:  &ServiceRole{Name: "lambda"},
+	}
+
+	if err := c.AddPolicyTemplate(pt); err != nil {
+		t.Fatalf("AddPolicyTemplate: %v", err)
+	}
+
+	if _, err := c.AddAttachment("assume-role", PrincipalUser, "alice", nil); err == nil {
+		t.Fatal("expected AddAttachment to reject a service-role template on a user principal")
+	}
+}
@@ -0,0 +1,318 @@
+package amper
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/igorzg/terraform-provider-amper/retry"
+)
+
+// attachmentState records what Reconcile last observed attached to a
+// single principal in AWS, keyed by "<PrincipalType>:<PrincipalName>".
+// Every Reconcile call re-pages through IAM for every targeted principal
+// and overwrites the record; Reconcile does not read it back.
+type attachmentState struct {
+	managedPolicies []AttachedPolicy
+	inlinePolicies  []string
+}
+
+// ReconcileDiff summarizes the result of Container.Reconcile.
+type ReconcileDiff struct {
+	// Added is reserved for when amper starts attaching managed policies
+	// itself; Reconcile never populates it today, and callers must not
+	// wire plan/apply logic off it yet.
+	Added []*Attachment
+
+	// Removed lists out-of-band managed policy attachments that were
+	// detached because they don't correspond to any *Attachment.
+	Removed []AttachedPolicy
+
+	// Drifted lists the same out-of-band attachments as Removed, but is
+	// populated instead of it when a ReconcileOption asked Reconcile to
+	// report without mutating AWS.
+	Drifted []AttachedPolicy
+
+	// RemovedInlinePolicies lists out-of-band inline role policies that
+	// were deleted because their name wasn't passed to
+	// WithOwnedInlinePolicyNames.
+	RemovedInlinePolicies []string
+
+	// DriftedInlinePolicies lists the same out-of-band inline policies as
+	// RemovedInlinePolicies, but is populated instead of it when a
+	// ReconcileOption asked Reconcile to report without mutating AWS.
+	DriftedInlinePolicies []string
+}
+
+func (d *ReconcileDiff) isClean() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Drifted) == 0 &&
+		len(d.RemovedInlinePolicies) == 0 && len(d.DriftedInlinePolicies) == 0
+}
+
+// ReconcileOption customizes a single Container.Reconcile call.
+type ReconcileOption func(*reconcileOptions)
+
+type reconcileOptions struct {
+	dryRun         bool
+	keepAWSManaged bool
+
+	// ownedInlinePolicies maps a role name to the set of inline policy
+	// names WithOwnedInlinePolicyNames declared for that role.
+	ownedInlinePolicies map[string]map[string]bool
+}
+
+// WithDryRun reports drift without detaching anything; out-of-band
+// attachments are returned in ReconcileDiff.Drifted instead of Removed.
+func WithDryRun() ReconcileOption {
+	return func(o *reconcileOptions) {
+		o.dryRun = true
+	}
+}
+
+// WithKeepAWSManagedPolicies leaves attachments of AWS-managed policies
+// (arn:aws:iam::aws:policy/...) untouched, even when they are not
+// present in c.attachments.
+func WithKeepAWSManagedPolicies() ReconcileOption {
+	return func(o *reconcileOptions) {
+		o.keepAWSManaged = true
+	}
+}
+
+// WithOwnedInlinePolicyNames tells Reconcile which inline policy names
+// the caller itself manages on roleName (outside amper, e.g. a Terraform
+// resource applying a Container's rendered AccountRolePolicies), so
+// Reconcile leaves them attached on that role. amper never names or
+// applies inline policies itself, so without this option every inline
+// policy found on a targeted role is treated as out of band.
+func WithOwnedInlinePolicyNames(roleName string, names ...string) ReconcileOption {
+	return func(o *reconcileOptions) {
+		if o.ownedInlinePolicies == nil {
+			o.ownedInlinePolicies = make(map[string]map[string]bool)
+		}
+
+		if o.ownedInlinePolicies[roleName] == nil {
+			o.ownedInlinePolicies[roleName] = make(map[string]bool, len(names))
+		}
+
+		for _, n := range names {
+			o.ownedInlinePolicies[roleName][n] = true
+		}
+	}
+}
+
+func isAWSManagedPolicyARN(arn string) bool {
+	return strings.HasPrefix(arn, "arn:aws:iam::aws:policy/")
+}
+
+// Reconcile renders the container's Policy, then, when the container is
+// exclusive, walks every principal targeted by c.attachments and compares
+// what managed policies (customer- or AWS-managed) are actually attached
+// to it in AWS against what amper expects, and, for role principals, what inline
+// policies are attached against WithOwnedInlinePolicyNames. Anything
+// extra is reported in the returned ReconcileDiff and, unless WithDryRun
+// is set, removed.
+//
+// Reconcile has no way to read back a role's trust policy, so it cannot
+// compare it against a rendered ServiceRole; service-role drift is
+// neither reported nor removed. See IAMClient.
+func (c *Container) Reconcile(ctx context.Context, opts ...ReconcileOption) (*Policy, *ReconcileDiff, error) {
+	options := &reconcileOptions{}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	policy, err, missing := c.Policy()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(missing) > 0 {
+		return nil, nil, fmt.Errorf("cannot reconcile container '%s': %d attachment(s) resolved to no policy", c.ID, len(missing))
+	}
+
+	diff := &ReconcileDiff{}
+
+	if !c.exclusive {
+		return policy, diff, nil
+	}
+
+	c.amper.RLock()
+	iam := c.amper.iam
+	retryPolicy := c.amper.RetryPolicy
+	isRetryable := c.amper.RetryableIAMError
+	c.amper.RUnlock()
+
+	if iam == nil {
+		return nil, nil, fmt.Errorf("cannot reconcile container '%s': no IAM client configured on the kernel", c.ID)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.attachmentState == nil {
+		c.attachmentState = make(map[string]*attachmentState)
+	}
+
+	for _, principal := range c.targetPrincipals() {
+		name := principal.PrincipalName()
+		stateKey := string(principal.PrincipalType()) + ":" + name
+
+		expectedARNs := make(map[string]bool, len(policy.AccountManagedPolicyARNs[stateKey]))
+
+		for _, arn := range policy.AccountManagedPolicyARNs[stateKey] {
+			expectedARNs[arn] = true
+		}
+
+		list, detach := iamReconcileFuncs(iam, principal.PrincipalType())
+
+		observed, err := listAllAttachedPolicies(func(marker string) (AttachedPoliciesPage, error) {
+			var page AttachedPoliciesPage
+
+			err := retry.Do(ctx, retryPolicy, func(ctx context.Context) error {
+				var err error
+				page, err = list(ctx, name, marker)
+				return err
+			}, isRetryable)
+
+			return page, err
+		})
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot list attached policies for %s '%s': %w", principal.PrincipalType(), name, err)
+		}
+
+		state := &attachmentState{managedPolicies: observed}
+		c.attachmentState[stateKey] = state
+
+		for _, ap := range observed {
+			if expectedARNs[ap.PolicyArn] {
+				continue
+			}
+
+			if options.keepAWSManaged && isAWSManagedPolicyARN(ap.PolicyArn) {
+				continue
+			}
+
+			// Anything left is attached in AWS but neither declared via
+			// a PolicyTemplate's ManagedPolicyARNs nor an AWS-managed
+			// policy kept by WithKeepAWSManagedPolicies, so it's out of
+			// band.
+			if options.dryRun {
+				diff.Drifted = append(diff.Drifted, ap)
+				continue
+			}
+
+			err := retry.Do(ctx, retryPolicy, func(ctx context.Context) error {
+				return detach(ctx, name, ap.PolicyArn)
+			}, isRetryable)
+
+			if err != nil {
+				return nil, nil, fmt.Errorf("cannot detach policy '%s' from %s '%s': %w", ap.PolicyArn, principal.PrincipalType(), name, err)
+			}
+
+			diff.Removed = append(diff.Removed, ap)
+		}
+
+		if principal.PrincipalType() != PrincipalRole {
+			continue
+		}
+
+		inlineNames, err := listAllInlinePolicyNames(func(marker string) (InlinePoliciesPage, error) {
+			var page InlinePoliciesPage
+
+			err := retry.Do(ctx, retryPolicy, func(ctx context.Context) error {
+				var err error
+				page, err = iam.ListRolePolicies(ctx, name, marker)
+				return err
+			}, isRetryable)
+
+			return page, err
+		})
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot list inline policies for role '%s': %w", name, err)
+		}
+
+		state.inlinePolicies = inlineNames
+
+		for _, policyName := range inlineNames {
+			if options.ownedInlinePolicies[name][policyName] {
+				continue
+			}
+
+			// Anything left is an inline policy attached in AWS that
+			// wasn't named via WithOwnedInlinePolicyNames, so it's out of
+			// band.
+			if options.dryRun {
+				diff.DriftedInlinePolicies = append(diff.DriftedInlinePolicies, policyName)
+				continue
+			}
+
+			err := retry.Do(ctx, retryPolicy, func(ctx context.Context) error {
+				return iam.DeleteRolePolicy(ctx, name, policyName)
+			}, isRetryable)
+
+			if err != nil {
+				return nil, nil, fmt.Errorf("cannot delete inline policy '%s' from role '%s': %w", policyName, name, err)
+			}
+
+			diff.RemovedInlinePolicies = append(diff.RemovedInlinePolicies, policyName)
+		}
+	}
+
+	sortAttachedPolicies(diff.Removed)
+	sortAttachedPolicies(diff.Drifted)
+	sort.Strings(diff.RemovedInlinePolicies)
+	sort.Strings(diff.DriftedInlinePolicies)
+
+	return policy, diff, nil
+}
+
+// targetPrincipals returns the distinct principals targeted by
+// c.attachments, in a deterministic order.
+func (c *Container) targetPrincipals() []Principal {
+	seen := make(map[string]bool)
+	var principals []Principal
+
+	for _, a := range c.attachments {
+		key := string(a.principal.PrincipalType()) + ":" + a.principal.PrincipalName()
+
+		if !seen[key] {
+			seen[key] = true
+			principals = append(principals, a.principal)
+		}
+	}
+
+	sort.Slice(principals, func(i, j int) bool {
+		if principals[i].PrincipalType() != principals[j].PrincipalType() {
+			return principals[i].PrincipalType() < principals[j].PrincipalType()
+		}
+
+		return principals[i].PrincipalName() < principals[j].PrincipalName()
+	})
+
+	return principals
+}
+
+type listAttachedPoliciesFunc func(ctx context.Context, name, marker string) (AttachedPoliciesPage, error)
+type detachPolicyFunc func(ctx context.Context, name, policyArn string) error
+
+func iamReconcileFuncs(iam IAMClient, pType PrincipalType) (listAttachedPoliciesFunc, detachPolicyFunc) {
+	switch pType {
+	case PrincipalUser:
+		return iam.ListAttachedUserPolicies, iam.DetachUserPolicy
+	case PrincipalGroup:
+		return iam.ListAttachedGroupPolicies, iam.DetachGroupPolicy
+	default:
+		return iam.ListAttachedRolePolicies, iam.DetachRolePolicy
+	}
+}
+
+func sortAttachedPolicies(policies []AttachedPolicy) {
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].PolicyArn < policies[j].PolicyArn
+	})
+}
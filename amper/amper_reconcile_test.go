@@ -0,0 +1,436 @@
+package amper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/igorzg/terraform-provider-amper/retry"
+)
+
+// fakeAPIError stands in for a smithy.APIError carrying the given
+// service error code, without pulling in the AWS SDK.
+type fakeAPIError struct{ code string }
+
+func (e fakeAPIError) Error() string     { return e.code }
+func (e fakeAPIError) ErrorCode() string { return e.code }
+
+type fakeIAMClient struct {
+	rolePolicies   map[string][]AttachedPolicy
+	detached       map[string][]string
+	inlinePolicies map[string][]string
+	deletedInline  map[string][]string
+
+	// listFailures, when > 0, makes the first N ListAttachedRolePolicies
+	// calls fail with a ConcurrentModificationException before succeeding.
+	listFailures int
+	listCalls    int
+
+	// detachFailures, when > 0, makes the first N DetachRolePolicy calls
+	// fail with a ConcurrentModificationException before succeeding.
+	detachFailures int
+	detachCalls    int
+}
+
+func newFakeIAMClient() *fakeIAMClient {
+	return &fakeIAMClient{
+		rolePolicies:   make(map[string][]AttachedPolicy),
+		detached:       make(map[string][]string),
+		inlinePolicies: make(map[string][]string),
+		deletedInline:  make(map[string][]string),
+	}
+}
+
+func (f *fakeIAMClient) ListAttachedRolePolicies(ctx context.Context, roleName, marker string) (AttachedPoliciesPage, error) {
+	f.listCalls++
+
+	if f.listCalls <= f.listFailures {
+		return AttachedPoliciesPage{}, fakeAPIError{code: "ConcurrentModificationException"}
+	}
+
+	return AttachedPoliciesPage{Policies: f.rolePolicies[roleName]}, nil
+}
+
+func (f *fakeIAMClient) ListAttachedUserPolicies(ctx context.Context, userName, marker string) (AttachedPoliciesPage, error) {
+	return AttachedPoliciesPage{}, nil
+}
+
+func (f *fakeIAMClient) ListAttachedGroupPolicies(ctx context.Context, groupName, marker string) (AttachedPoliciesPage, error) {
+	return AttachedPoliciesPage{}, nil
+}
+
+func (f *fakeIAMClient) DetachRolePolicy(ctx context.Context, roleName, policyArn string) error {
+	f.detachCalls++
+
+	if f.detachCalls <= f.detachFailures {
+		return fakeAPIError{code: "ConcurrentModificationException"}
+	}
+
+	f.detached[roleName] = append(f.detached[roleName], policyArn)
+
+	var kept []AttachedPolicy
+
+	for _, p := range f.rolePolicies[roleName] {
+		if p.PolicyArn != policyArn {
+			kept = append(kept, p)
+		}
+	}
+
+	f.rolePolicies[roleName] = kept
+
+	return nil
+}
+
+func (f *fakeIAMClient) DetachUserPolicy(ctx context.Context, userName, policyArn string) error {
+	return nil
+}
+
+func (f *fakeIAMClient) DetachGroupPolicy(ctx context.Context, groupName, policyArn string) error {
+	return nil
+}
+
+func (f *fakeIAMClient) ListRolePolicies(ctx context.Context, roleName, marker string) (InlinePoliciesPage, error) {
+	return InlinePoliciesPage{PolicyNames: f.inlinePolicies[roleName]}, nil
+}
+
+func (f *fakeIAMClient) DeleteRolePolicy(ctx context.Context, roleName, policyName string) error {
+	f.deletedInline[roleName] = append(f.deletedInline[roleName], policyName)
+
+	var kept []string
+
+	for _, n := range f.inlinePolicies[roleName] {
+		if n != policyName {
+			kept = append(kept, n)
+		}
+	}
+
+	f.inlinePolicies[roleName] = kept
+
+	return nil
+}
+
+func newTestContainer(t *testing.T, iam IAMClient) *Container {
+	t.Helper()
+
+	k := NewKernel()
+	k.SetIAMClient(iam)
+
+	if err := k.AddAccount(&Account{Name: "svc-role"}); err != nil {
+		t.Fatalf("AddAccount: %v", err)
+	}
+
+	c := k.NewContainer("test")
+
+	pt := &PolicyTemplate{
+		Key:          "allow-s3",
+		Scope:        []string{"s3:*"},
+		DocumentJSON: `{"Version":"2012-10-17","Statement":[{"Sid":"AllowS3","Effect":"Allow","Action":["s3:GetObject"],"Resource":["*"]}]}`,
+	}
+
+	if err := c.AddPolicyTemplate(pt); err != nil {
+		t.Fatalf("AddPolicyTemplate: %v", err)
+	}
+
+	if _, err := c.AddAttachment("allow-s3", PrincipalRole, "svc-role", nil); err != nil {
+		t.Fatalf("AddAttachment: %v", err)
+	}
+
+	return c
+}
+
+func TestReconcile_SurfacesOutOfBandAttachment(t *testing.T) {
+	iam := newFakeIAMClient()
+	iam.rolePolicies["svc-role"] = []AttachedPolicy{
+		{PolicyName: "rogue", PolicyArn: "arn:aws:iam::111122223333:policy/rogue"},
+	}
+
+	c := newTestContainer(t, iam)
+	c.SetExclusive(true)
+
+	_, diff, err := c.Reconcile(context.Background(), WithDryRun())
+
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	if len(diff.Drifted) != 1 || diff.Drifted[0].PolicyArn != "arn:aws:iam::111122223333:policy/rogue" {
+		t.Fatalf("expected rogue policy to be reported as drifted, got %+v", diff.Drifted)
+	}
+
+	if len(iam.detached["svc-role"]) != 0 {
+		t.Fatalf("dry run must not detach anything, detached %+v", iam.detached)
+	}
+}
+
+func TestReconcile_RemovesOutOfBandAttachment(t *testing.T) {
+	iam := newFakeIAMClient()
+	iam.rolePolicies["svc-role"] = []AttachedPolicy{
+		{PolicyName: "rogue", PolicyArn: "arn:aws:iam::111122223333:policy/rogue"},
+	}
+
+	c := newTestContainer(t, iam)
+	c.SetExclusive(true)
+
+	_, diff, err := c.Reconcile(context.Background())
+
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	if len(diff.Removed) != 1 || diff.Removed[0].PolicyArn != "arn:aws:iam::111122223333:policy/rogue" {
+		t.Fatalf("expected rogue policy to be removed, got %+v", diff.Removed)
+	}
+
+	if len(iam.rolePolicies["svc-role"]) != 0 {
+		t.Fatalf("expected rogue policy to be detached from AWS, got %+v", iam.rolePolicies["svc-role"])
+	}
+}
+
+func TestReconcile_RemovesOutOfBandInlinePolicy(t *testing.T) {
+	iam := newFakeIAMClient()
+	iam.inlinePolicies["svc-role"] = []string{"rogue-inline"}
+
+	c := newTestContainer(t, iam)
+	c.SetExclusive(true)
+
+	_, diff, err := c.Reconcile(context.Background())
+
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	if len(diff.RemovedInlinePolicies) != 1 || diff.RemovedInlinePolicies[0] != "rogue-inline" {
+		t.Fatalf("expected rogue-inline to be removed, got %+v", diff.RemovedInlinePolicies)
+	}
+
+	if len(iam.inlinePolicies["svc-role"]) != 0 {
+		t.Fatalf("expected rogue-inline to be deleted from AWS, got %+v", iam.inlinePolicies["svc-role"])
+	}
+}
+
+func TestReconcile_DryRunReportsInlinePolicyWithoutDeleting(t *testing.T) {
+	iam := newFakeIAMClient()
+	iam.inlinePolicies["svc-role"] = []string{"rogue-inline"}
+
+	c := newTestContainer(t, iam)
+	c.SetExclusive(true)
+
+	_, diff, err := c.Reconcile(context.Background(), WithDryRun())
+
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	if len(diff.DriftedInlinePolicies) != 1 || diff.DriftedInlinePolicies[0] != "rogue-inline" {
+		t.Fatalf("expected rogue-inline to be reported as drifted, got %+v", diff.DriftedInlinePolicies)
+	}
+
+	if len(iam.deletedInline["svc-role"]) != 0 {
+		t.Fatalf("dry run must not delete anything, deleted %+v", iam.deletedInline)
+	}
+}
+
+func TestReconcile_LeavesOwnedInlinePolicyAttached(t *testing.T) {
+	iam := newFakeIAMClient()
+	iam.inlinePolicies["svc-role"] = []string{"test"}
+
+	c := newTestContainer(t, iam)
+	c.SetExclusive(true)
+
+	_, diff, err := c.Reconcile(context.Background(), WithOwnedInlinePolicyNames("svc-role", "test"))
+
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	if !diff.isClean() {
+		t.Fatalf("expected an owned inline policy name not to be reported as drift, got %+v", diff)
+	}
+
+	if len(iam.inlinePolicies["svc-role"]) != 1 {
+		t.Fatalf("expected the owned inline policy to remain attached, got %+v", iam.inlinePolicies["svc-role"])
+	}
+}
+
+func TestReconcile_OwnedInlinePolicyNameDoesNotLeakAcrossRoles(t *testing.T) {
+	iam := newFakeIAMClient()
+	iam.inlinePolicies["role-a"] = []string{"extra-permissions"}
+	iam.inlinePolicies["role-b"] = []string{"extra-permissions"}
+
+	k := NewKernel()
+	k.SetIAMClient(iam)
+
+	if err := k.AddAccount(&Account{Name: "role-a"}); err != nil {
+		t.Fatalf("AddAccount: %v", err)
+	}
+
+	if err := k.AddAccount(&Account{Name: "role-b"}); err != nil {
+		t.Fatalf("AddAccount: %v", err)
+	}
+
+	c := k.NewContainer("test")
+
+	pt := &PolicyTemplate{
+		Key:          "allow-s3",
+		Scope:        []string{"s3:*"},
+		DocumentJSON: `{"Version":"2012-10-17","Statement":[{"Sid":"AllowS3","Effect":"Allow","Action":["s3:GetObject"],"Resource":["*"]}]}`,
+	}
+
+	if err := c.AddPolicyTemplate(pt); err != nil {
+		t.Fatalf("AddPolicyTemplate: %v", err)
+	}
+
+	if _, err := c.AddAttachment("allow-s3", PrincipalRole, "role-a", nil); err != nil {
+		t.Fatalf("AddAttachment role-a: %v", err)
+	}
+
+	if _, err := c.AddAttachment("allow-s3", PrincipalRole, "role-b", nil); err != nil {
+		t.Fatalf("AddAttachment role-b: %v", err)
+	}
+
+	c.SetExclusive(true)
+
+	_, diff, err := c.Reconcile(context.Background(), WithOwnedInlinePolicyNames("role-a", "extra-permissions"))
+
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	if len(diff.RemovedInlinePolicies) != 1 || diff.RemovedInlinePolicies[0] != "extra-permissions" {
+		t.Fatalf("expected role-b's same-named inline policy to be removed as drift, got %+v", diff.RemovedInlinePolicies)
+	}
+
+	if len(iam.inlinePolicies["role-a"]) != 1 {
+		t.Fatalf("expected role-a's owned inline policy to remain attached, got %+v", iam.inlinePolicies["role-a"])
+	}
+
+	if len(iam.inlinePolicies["role-b"]) != 0 {
+		t.Fatalf("expected role-b's out-of-band inline policy to be removed, got %+v", iam.inlinePolicies["role-b"])
+	}
+}
+
+func TestReconcile_LeavesDeclaredManagedPolicyARNAttached(t *testing.T) {
+	iam := newFakeIAMClient()
+	iam.rolePolicies["svc-role"] = []AttachedPolicy{
+		{PolicyName: "ReadOnlyAccess", PolicyArn: "arn:aws:iam::aws:policy/ReadOnlyAccess"},
+	}
+
+	k := NewKernel()
+	k.SetIAMClient(iam)
+
+	if err := k.AddAccount(&Account{Name: "svc-role"}); err != nil {
+		t.Fatalf("AddAccount: %v", err)
+	}
+
+	c := k.NewContainer("test")
+
+	pt := &PolicyTemplate{
+		Key:               "read-only",
+		ManagedPolicyARNs: []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"},
+		DocumentJSON:      `{"Version":"2012-10-17","Statement":[{"Sid":"AllowGet","Effect":"Allow","Action":["s3:GetObject"],"Resource":["*"]}]}`,
+	}
+
+	if err := c.AddPolicyTemplate(pt); err != nil {
+		t.Fatalf("AddPolicyTemplate: %v", err)
+	}
+
+	if _, err := c.AddAttachment("read-only", PrincipalRole, "svc-role", nil); err != nil {
+		t.Fatalf("AddAttachment: %v", err)
+	}
+
+	c.SetExclusive(true)
+
+	_, diff, err := c.Reconcile(context.Background())
+
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	if !diff.isClean() {
+		t.Fatalf("expected a declared ManagedPolicyARN not to be reported as drift, got %+v", diff)
+	}
+
+	if len(iam.detached["svc-role"]) != 0 {
+		t.Fatalf("expected a declared ManagedPolicyARN not to be detached, detached %+v", iam.detached)
+	}
+
+	if len(iam.rolePolicies["svc-role"]) != 1 {
+		t.Fatalf("expected the declared ManagedPolicyARN to remain attached, got %+v", iam.rolePolicies["svc-role"])
+	}
+}
+
+func TestReconcile_RetriesConcurrentModificationException(t *testing.T) {
+	iam := newFakeIAMClient()
+	iam.rolePolicies["svc-role"] = []AttachedPolicy{
+		{PolicyName: "rogue", PolicyArn: "arn:aws:iam::111122223333:policy/rogue"},
+	}
+	iam.listFailures = 2
+	iam.detachFailures = 2
+
+	c := newTestContainer(t, iam)
+	c.SetExclusive(true)
+	c.amper.RetryPolicy = retry.Policy{MaxAttempts: 5, BaseDelay: time.Millisecond}
+
+	_, diff, err := c.Reconcile(context.Background())
+
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	if len(diff.Removed) != 1 || diff.Removed[0].PolicyArn != "arn:aws:iam::111122223333:policy/rogue" {
+		t.Fatalf("expected rogue policy to be removed, got %+v", diff.Removed)
+	}
+
+	if iam.listCalls != 3 {
+		t.Fatalf("expected List to be retried twice before succeeding, got %d calls", iam.listCalls)
+	}
+
+	if iam.detachCalls != 3 {
+		t.Fatalf("expected Detach to be retried twice before succeeding, got %d calls", iam.detachCalls)
+	}
+}
+
+func TestReconcile_GivesUpAfterMaxAttempts(t *testing.T) {
+	iam := newFakeIAMClient()
+	iam.rolePolicies["svc-role"] = []AttachedPolicy{
+		{PolicyName: "rogue", PolicyArn: "arn:aws:iam::111122223333:policy/rogue"},
+	}
+	iam.listFailures = 10
+
+	c := newTestContainer(t, iam)
+	c.SetExclusive(true)
+	c.amper.RetryPolicy = retry.Policy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+
+	_, _, err := c.Reconcile(context.Background())
+
+	if err == nil {
+		t.Fatal("expected Reconcile to surface the exhausted retry error")
+	}
+
+	if iam.listCalls != 3 {
+		t.Fatalf("expected exactly 3 attempts, got %d", iam.listCalls)
+	}
+}
+
+func TestReconcile_NonExclusiveLeavesAWSUntouched(t *testing.T) {
+	iam := newFakeIAMClient()
+	iam.rolePolicies["svc-role"] = []AttachedPolicy{
+		{PolicyName: "rogue", PolicyArn: "arn:aws:iam::111122223333:policy/rogue"},
+	}
+
+	c := newTestContainer(t, iam)
+
+	_, diff, err := c.Reconcile(context.Background())
+
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	if !diff.isClean() {
+		t.Fatalf("expected a clean diff for a non-exclusive container, got %+v", diff)
+	}
+
+	if len(iam.rolePolicies["svc-role"]) != 1 {
+		t.Fatalf("non-exclusive reconcile must not touch AWS, got %+v", iam.rolePolicies["svc-role"])
+	}
+}
@@ -0,0 +1,35 @@
+package amper
+
+import "errors"
+
+// apiError is satisfied by AWS SDK v2 errors that carry a service error
+// code (smithy.APIError), without requiring amper to depend on the SDK.
+type apiError interface {
+	ErrorCode() string
+}
+
+// httpStatusError is satisfied by AWS SDK v2 transport errors that carry
+// the HTTP status code of the failed request (smithyhttp.ResponseError).
+type httpStatusError interface {
+	HTTPStatusCode() int
+}
+
+// DefaultIsRetryableIAMError matches the errors IAM's attach/detach/put
+// /delete calls return under concurrent Terraform applies:
+// ConcurrentModificationException, throttling, and 5xx responses.
+// Kernel.RetryableIAMError defaults to this; callers can widen it to
+// retry on more error codes.
+func DefaultIsRetryableIAMError(err error) bool {
+	var apiErr apiError
+
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "ConcurrentModificationException", "Throttling", "ThrottlingException":
+			return true
+		}
+	}
+
+	var httpErr httpStatusError
+
+	return errors.As(err, &httpErr) && httpErr.HTTPStatusCode() >= 500
+}
@@ -0,0 +1,88 @@
+package amper
+
+import "strings"
+
+// AttachmentContext carries the attachment-specific information a
+// PolicyValidator needs to judge a rendered document: which container
+// and principal it is being rendered for, and the vars it was rendered
+// with.
+type AttachmentContext struct {
+	Container *Container
+	Principal Principal
+	Vars      map[string]string
+}
+
+// PolicyValidator is amper's admission-controller extension point. A
+// Kernel can carry any number of them; every one runs on every template
+// and every rendered document, so a module consumer can enforce org-wide
+// policy hygiene without forking amper.
+type PolicyValidator interface {
+	// ValidateTemplate runs once, when a PolicyTemplate is registered on
+	// a Container via AddPolicyTemplate, before any attachment renders it.
+	ValidateTemplate(pt *PolicyTemplate) error
+
+	// ValidateRendered runs once per attachment, after PolicyTemplate
+	// has rendered a document for a specific principal and vars.
+	ValidateRendered(pt *PolicyTemplate, doc *IAMPolicyDoc, ctx AttachmentContext) error
+}
+
+// ValidationErrors aggregates every validator failure for a single
+// template or rendered document so callers see the whole picture
+// instead of only the first failure.
+type ValidationErrors []error
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// RegisterValidator adds a PolicyValidator that runs on every template
+// and rendered document from this point on. Validators already-rendered
+// documents were checked against are not retroactively re-validated.
+func (k *Kernel) RegisterValidator(v PolicyValidator) {
+	k.Lock()
+	defer k.Unlock()
+
+	k.validators = append(k.validators, v)
+}
+
+// validateTemplate runs every registered validator's ValidateTemplate.
+// Callers must hold at least a read lock on k.
+func (k *Kernel) validateTemplate(pt *PolicyTemplate) error {
+	var errs ValidationErrors
+
+	for _, v := range k.validators {
+		if err := v.ValidateTemplate(pt); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// validateRendered runs every registered validator's ValidateRendered.
+// Callers must hold at least a read lock on k.
+func (k *Kernel) validateRendered(pt *PolicyTemplate, doc *IAMPolicyDoc, ctx AttachmentContext) error {
+	var errs ValidationErrors
+
+	for _, v := range k.validators {
+		if err := v.ValidateRendered(pt, doc, ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
@@ -0,0 +1,208 @@
+package amper
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPolicy_RunsRenderedValidators(t *testing.T) {
+	k := NewKernel()
+	k.RegisterValidator(NewRequireSidValidator())
+	k.RegisterValidator(NewScopeCoverageValidator())
+
+	if err := k.AddAccount(&Account{Name: "deploy-role"}); err != nil {
+		t.Fatalf("AddAccount: %v", err)
+	}
+
+	c := k.NewContainer("test")
+
+	pt := &PolicyTemplate{
+		Key:          "no-sid",
+		Scope:        []string{"iam:*"},
+		DocumentJSON: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:GetObject"],"Resource":["*"]}]}`,
+	}
+
+	if err := c.AddPolicyTemplate(pt); err != nil {
+		t.Fatalf("AddPolicyTemplate: %v", err)
+	}
+
+	if _, err := c.AddAttachment("no-sid", PrincipalRole, "deploy-role", nil); err != nil {
+		t.Fatalf("AddAttachment: %v", err)
+	}
+
+	_, err, _ := c.Policy()
+
+	if err == nil {
+		t.Fatal("expected Policy() to fail validation")
+	}
+
+	errs, ok := err.(ValidationErrors)
+
+	if !ok {
+		t.Fatalf("expected a ValidationErrors, got %T: %v", err, err)
+	}
+
+	if len(errs) != 1 {
+		t.Fatalf("expected one aggregated failure for the attachment, got %d: %v", len(errs), errs)
+	}
+
+	msg := errs[0].Error()
+
+	if !strings.Contains(msg, "missing an Sid") || !strings.Contains(msg, "not covered by declared scope") {
+		t.Fatalf("expected both the missing-Sid and scope-coverage failures to be aggregated into one message, got: %s", msg)
+	}
+}
+
+func TestScopeCoverageValidator_RejectsActionOutsidePartialServiceScope(t *testing.T) {
+	k := NewKernel()
+	k.RegisterValidator(NewScopeCoverageValidator())
+
+	if err := k.AddAccount(&Account{Name: "deploy-role"}); err != nil {
+		t.Fatalf("AddAccount: %v", err)
+	}
+
+	c := k.NewContainer("test")
+
+	pt := &PolicyTemplate{
+		Key:          "s3-get-only",
+		Scope:        []string{"s3:Get*"},
+		DocumentJSON: `{"Version":"2012-10-17","Statement":[{"Sid":"AllowDelete","Effect":"Allow","Action":["s3:DeleteBucket"],"Resource":["*"]}]}`,
+	}
+
+	if err := c.AddPolicyTemplate(pt); err != nil {
+		t.Fatalf("AddPolicyTemplate: %v", err)
+	}
+
+	if _, err := c.AddAttachment("s3-get-only", PrincipalRole, "deploy-role", nil); err != nil {
+		t.Fatalf("AddAttachment: %v", err)
+	}
+
+	_, err, _ := c.Policy()
+
+	if err == nil {
+		t.Fatal("expected Policy() to reject an action not covered by the partial-service scope")
+	}
+
+	errs, ok := err.(ValidationErrors)
+
+	if !ok {
+		t.Fatalf("expected a ValidationErrors, got %T: %v", err, err)
+	}
+
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "not covered by declared scope") {
+		t.Fatalf("expected a scope-coverage failure for s3:DeleteBucket, got: %v", errs)
+	}
+}
+
+func TestActionInScope(t *testing.T) {
+	cases := []struct {
+		action string
+		scope  []string
+		want   bool
+	}{
+		{"s3:GetObject", []string{"*"}, true},
+		{"s3:GetObject", []string{"s3:GetObject"}, true},
+		{"s3:GetObject", []string{"s3:Get*"}, true},
+		{"s3:DeleteBucket", []string{"s3:Get*"}, false},
+		{"s3:GetObject", []string{"*:Get*"}, true},
+		{"sts:AssumeRole", []string{"*:Get*"}, false},
+	}
+
+	for _, tc := range cases {
+		if got := actionInScope(tc.action, tc.scope); got != tc.want {
+			t.Errorf("actionInScope(%q, %v) = %v, want %v", tc.action, tc.scope, got, tc.want)
+		}
+	}
+}
+
+func TestWildcardAllowlistValidator_RejectsActionWildcardOnResourceWildcard(t *testing.T) {
+	k := NewKernel()
+	k.RegisterValidator(NewWildcardAllowlistValidator())
+
+	if err := k.AddAccount(&Account{Name: "deploy-role"}); err != nil {
+		t.Fatalf("AddAccount: %v", err)
+	}
+
+	c := k.NewContainer("test")
+
+	pt := &PolicyTemplate{
+		Key:          "admin",
+		DocumentJSON: `{"Version":"2012-10-17","Statement":[{"Sid":"AllowAdmin","Effect":"Allow","Action":["*"],"Resource":["*"]}]}`,
+	}
+
+	if err := c.AddPolicyTemplate(pt); err != nil {
+		t.Fatalf("AddPolicyTemplate: %v", err)
+	}
+
+	if _, err := c.AddAttachment("admin", PrincipalRole, "deploy-role", nil); err != nil {
+		t.Fatalf("AddAttachment: %v", err)
+	}
+
+	_, err, _ := c.Policy()
+
+	if err == nil {
+		t.Fatal("expected Policy() to reject Action:* on Resource:* for a key not in the allowlist")
+	}
+
+	errs, ok := err.(ValidationErrors)
+
+	if !ok {
+		t.Fatalf("expected a ValidationErrors, got %T: %v", err, err)
+	}
+
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "wildcard allowlist") {
+		t.Fatalf("expected a wildcard-allowlist failure, got: %v", errs)
+	}
+}
+
+func TestWildcardAllowlistValidator_AllowsExemptedKey(t *testing.T) {
+	k := NewKernel()
+	k.RegisterValidator(NewWildcardAllowlistValidator("admin"))
+
+	if err := k.AddAccount(&Account{Name: "deploy-role"}); err != nil {
+		t.Fatalf("AddAccount: %v", err)
+	}
+
+	c := k.NewContainer("test")
+
+	pt := &PolicyTemplate{
+		Key:          "admin",
+		DocumentJSON: `{"Version":"2012-10-17","Statement":[{"Sid":"AllowAdmin","Effect":"Allow","Action":["*"],"Resource":["*"]}]}`,
+	}
+
+	if err := c.AddPolicyTemplate(pt); err != nil {
+		t.Fatalf("AddPolicyTemplate: %v", err)
+	}
+
+	if _, err := c.AddAttachment("admin", PrincipalRole, "deploy-role", nil); err != nil {
+		t.Fatalf("AddAttachment: %v", err)
+	}
+
+	if _, err, missing := c.Policy(); err != nil {
+		t.Fatalf("expected Policy() to allow Action:*/Resource:* for an allowlisted key, got: %v (missing: %+v)", err, missing)
+	}
+}
+
+func TestAddPolicyTemplate_RunsTemplateValidators(t *testing.T) {
+	k := NewKernel()
+	k.RegisterValidator(rejectAllTemplates{})
+
+	c := k.NewContainer("test")
+
+	pt := &PolicyTemplate{Key: "anything", DocumentJSON: `{}`}
+
+	if err := c.AddPolicyTemplate(pt); err == nil {
+		t.Fatal("expected AddPolicyTemplate to fail validation")
+	}
+}
+
+type rejectAllTemplates struct{}
+
+func (rejectAllTemplates) ValidateTemplate(pt *PolicyTemplate) error {
+	return errors.New("template rejected")
+}
+
+func (rejectAllTemplates) ValidateRendered(pt *PolicyTemplate, doc *IAMPolicyDoc, ctx AttachmentContext) error {
+	return nil
+}
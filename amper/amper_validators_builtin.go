@@ -0,0 +1,150 @@
+package amper
+
+import (
+	"fmt"
+)
+
+// NewWildcardAllowlistValidator rejects any rendered "Allow" statement
+// whose Action and Resource are both "*", unless the owning
+// PolicyTemplate's Key is in allowedKeys.
+func NewWildcardAllowlistValidator(allowedKeys ...string) PolicyValidator {
+	allowed := make(map[string]bool, len(allowedKeys))
+
+	for _, k := range allowedKeys {
+		allowed[k] = true
+	}
+
+	return &wildcardAllowlistValidator{allowed: allowed}
+}
+
+type wildcardAllowlistValidator struct {
+	allowed map[string]bool
+}
+
+func (v *wildcardAllowlistValidator) ValidateTemplate(pt *PolicyTemplate) error {
+	return nil
+}
+
+func (v *wildcardAllowlistValidator) ValidateRendered(pt *PolicyTemplate, doc *IAMPolicyDoc, ctx AttachmentContext) error {
+	if doc == nil || v.allowed[pt.Key] {
+		return nil
+	}
+
+	for _, s := range doc.Statements {
+		if s.Effect == "Allow" && containsString(s.Actions, "*") && containsString(s.Resources, "*") {
+			return fmt.Errorf("statement '%s' allows Action:* on Resource:* and '%s' is not in the wildcard allowlist", s.Sid, pt.Key)
+		}
+	}
+
+	return nil
+}
+
+// NewRequireSidValidator rejects any rendered statement that doesn't
+// carry an Sid, so every statement in a generated policy can be
+// identified in AWS's console and CloudTrail.
+func NewRequireSidValidator() PolicyValidator {
+	return &requireSidValidator{}
+}
+
+type requireSidValidator struct{}
+
+func (requireSidValidator) ValidateTemplate(pt *PolicyTemplate) error {
+	return nil
+}
+
+func (requireSidValidator) ValidateRendered(pt *PolicyTemplate, doc *IAMPolicyDoc, ctx AttachmentContext) error {
+	if doc == nil {
+		return nil
+	}
+
+	for i, s := range doc.Statements {
+		if s.Sid == "" {
+			return fmt.Errorf("statement #%d is missing an Sid", i)
+		}
+	}
+
+	return nil
+}
+
+// NewScopeCoverageValidator rejects a rendered document if any of its
+// actions aren't covered by the owning PolicyTemplate's declared Scope,
+// catching templates whose Scope has drifted out of sync with what they
+// actually grant.
+func NewScopeCoverageValidator() PolicyValidator {
+	return &scopeCoverageValidator{}
+}
+
+type scopeCoverageValidator struct{}
+
+func (scopeCoverageValidator) ValidateTemplate(pt *PolicyTemplate) error {
+	return nil
+}
+
+func (scopeCoverageValidator) ValidateRendered(pt *PolicyTemplate, doc *IAMPolicyDoc, ctx AttachmentContext) error {
+	if doc == nil {
+		return nil
+	}
+
+	for _, s := range doc.Statements {
+		for _, action := range s.Actions {
+			if !actionInScope(action, pt.Scope) {
+				return fmt.Errorf("action '%s' is not covered by declared scope %v", action, pt.Scope)
+			}
+		}
+	}
+
+	return nil
+}
+
+func actionInScope(action string, scope []string) bool {
+	for _, pattern := range scope {
+		if actionGlobMatches(pattern, action) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// actionGlobMatches reports whether action matches an IAM-style wildcard
+// pattern, where "*" matches any number of characters (including none)
+// and "?" matches exactly one, over the whole "service:action" string
+// rather than just its service prefix.
+func actionGlobMatches(pattern, action string) bool {
+	sIdx, pIdx := 0, 0
+	starIdx, match := -1, 0
+
+	for sIdx < len(action) {
+		switch {
+		case pIdx < len(pattern) && (pattern[pIdx] == '?' || pattern[pIdx] == action[sIdx]):
+			sIdx++
+			pIdx++
+		case pIdx < len(pattern) && pattern[pIdx] == '*':
+			starIdx = pIdx
+			match = sIdx
+			pIdx++
+		case starIdx != -1:
+			pIdx = starIdx + 1
+			match++
+			sIdx = match
+		default:
+			return false
+		}
+	}
+
+	for pIdx < len(pattern) && pattern[pIdx] == '*' {
+		pIdx++
+	}
+
+	return pIdx == len(pattern)
+}
+
+func containsString(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,89 @@
+// Package retry provides a small, dependency-free retry-with-backoff
+// helper for operations (like AWS API calls) that fail transiently.
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// IsRetryableFunc reports whether an error returned by an operation
+// should be retried.
+type IsRetryableFunc func(error) bool
+
+// Policy controls how Do retries a failing operation.
+type Policy struct {
+	// MaxAttempts is the total number of times op is called, including
+	// the first attempt. Defaults to DefaultPolicy.MaxAttempts if <= 0.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry; each subsequent
+	// retry doubles it, capped at MaxDelay.
+	BaseDelay time.Duration
+
+	// MaxDelay caps the computed backoff delay. Zero means uncapped.
+	MaxDelay time.Duration
+
+	// Jitter randomizes the computed delay by +/- Jitter/2 as a
+	// fraction of it (0..1). Zero disables jitter.
+	Jitter float64
+}
+
+// DefaultPolicy is a ready-made Policy for AWS API calls. Do itself only
+// falls back to DefaultPolicy.MaxAttempts when a Policy's MaxAttempts is
+// <= 0; its other fields are not substituted for zero values.
+var DefaultPolicy = Policy{
+	MaxAttempts: 5,
+	BaseDelay:   200 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+	Jitter:      0.2,
+}
+
+// Do runs op, retrying with exponential backoff while isRetryable(err)
+// returns true and the policy's MaxAttempts hasn't been exhausted. It
+// returns early if ctx is canceled while waiting between attempts. A nil
+// isRetryable never retries.
+func Do(ctx context.Context, policy Policy, op func(ctx context.Context) error, isRetryable IsRetryableFunc) error {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = DefaultPolicy.MaxAttempts
+	}
+
+	var err error
+
+	for attempt := 0; attempt < policy.MaxAttempts; attempt++ {
+		err = op(ctx)
+
+		if err == nil {
+			return nil
+		}
+
+		if isRetryable == nil || !isRetryable(err) || attempt == policy.MaxAttempts-1 {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff(policy, attempt)):
+		}
+	}
+
+	return err
+}
+
+func backoff(policy Policy, attempt int) time.Duration {
+	delay := policy.BaseDelay << attempt
+
+	if policy.MaxDelay > 0 && (delay <= 0 || delay > policy.MaxDelay) {
+		delay = policy.MaxDelay
+	}
+
+	if policy.Jitter <= 0 {
+		return delay
+	}
+
+	spread := float64(delay) * policy.Jitter
+
+	return delay - time.Duration(spread/2) + time.Duration(rand.Float64()*spread)
+}
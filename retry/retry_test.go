@@ -0,0 +1,91 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errRetryable = errors.New("retryable")
+var errFatal = errors.New("fatal")
+
+func isRetryable(err error) bool {
+	return errors.Is(err, errRetryable)
+}
+
+func TestDo_RetriesUntilSuccess(t *testing.T) {
+	attempts := 0
+
+	err := Do(context.Background(), Policy{MaxAttempts: 5, BaseDelay: time.Millisecond}, func(ctx context.Context) error {
+		attempts++
+
+		if attempts < 3 {
+			return errRetryable
+		}
+
+		return nil
+	}, isRetryable)
+
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestDo_StopsOnNonRetryableError(t *testing.T) {
+	attempts := 0
+
+	err := Do(context.Background(), Policy{MaxAttempts: 5, BaseDelay: time.Millisecond}, func(ctx context.Context) error {
+		attempts++
+		return errFatal
+	}, isRetryable)
+
+	if !errors.Is(err, errFatal) {
+		t.Fatalf("expected errFatal, got %v", err)
+	}
+
+	if attempts != 1 {
+		t.Fatalf("expected 1 attempt, got %d", attempts)
+	}
+}
+
+func TestDo_ExhaustsMaxAttempts(t *testing.T) {
+	attempts := 0
+
+	err := Do(context.Background(), Policy{MaxAttempts: 3, BaseDelay: time.Millisecond}, func(ctx context.Context) error {
+		attempts++
+		return errRetryable
+	}, isRetryable)
+
+	if !errors.Is(err, errRetryable) {
+		t.Fatalf("expected errRetryable, got %v", err)
+	}
+
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestDo_StopsOnContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	attempts := 0
+
+	err := Do(ctx, Policy{MaxAttempts: 5, BaseDelay: time.Millisecond}, func(ctx context.Context) error {
+		attempts++
+		return errRetryable
+	}, isRetryable)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	if attempts != 1 {
+		t.Fatalf("expected 1 attempt before the cancel was observed, got %d", attempts)
+	}
+}